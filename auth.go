@@ -0,0 +1,116 @@
+package onion
+
+import (
+	"net"
+	"time"
+
+	"github.com/crackcomm/onion/internal/accept"
+)
+
+// Authorizer - Authorizes a peer after all layers of the onion handshake.
+type Authorizer interface {
+	// Authorize - Returns an error if the peer is not authorized.
+	// Rejected connections are closed by the onion.
+	Authorize(net.Conn) error
+}
+
+// AuthorizerFunc - Authorizer function.
+type AuthorizerFunc func(net.Conn) error
+
+// Authorize - Calls the authorizer function.
+func (fn AuthorizerFunc) Authorize(conn net.Conn) error {
+	return fn(conn)
+}
+
+// Authorizers - Authorizer that requires all authorizers to accept a peer.
+type Authorizers []Authorizer
+
+// Authorize - Returns first authorization error.
+func (auths Authorizers) Authorize(conn net.Conn) error {
+	for _, auth := range auths {
+		if err := auth.Authorize(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WrappedConn - Connection wrapping an underlying connection.
+// Layers should implement it on their connections so authorizers
+// can find peer identity established by inner layers.
+type WrappedConn interface {
+	net.Conn
+
+	// NetConn - Returns the underlying connection.
+	NetConn() net.Conn
+}
+
+// Walk - Calls fn on the connection and all connections it wraps,
+// starting from the outermost one, until fn returns false.
+func Walk(conn net.Conn, fn func(net.Conn) bool) {
+	for conn != nil && fn(conn) {
+		wrapped, ok := conn.(WrappedConn)
+		if !ok {
+			return
+		}
+		conn = wrapped.NetConn()
+	}
+}
+
+// WithAuthorizer - Returns an onion that authorizes every dialed
+// and accepted connection, closing rejected ones.
+func WithAuthorizer(o Onion, auth Authorizer) Onion {
+	return &authOnion{Onion: o, auth: auth}
+}
+
+type authOnion struct {
+	Onion
+	auth Authorizer
+}
+
+// Layers - Returns layers of the wrapped onion.
+func (on *authOnion) Layers() []Layer {
+	return Layers(on.Onion)
+}
+
+// Dial - Dials to a target through an onion and authorizes the peer.
+func (on *authOnion) Dial(network, addr string) (net.Conn, error) {
+	conn, err := on.Onion.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return authorize(on.auth, conn)
+}
+
+// Connect - Connects to a target through an onion and authorizes the peer.
+func (on *authOnion) Connect(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := on.Onion.Connect(addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return authorize(on.auth, conn)
+}
+
+// Listener - Wraps a listener with an onion and authorizes accepted peers.
+// Peers are authorized concurrently with a deadline, rejected connections
+// are closed and never returned.
+func (on *authOnion) Listener(in net.Listener) (net.Listener, error) {
+	l, err := on.Onion.Listener(in)
+	if err != nil {
+		return nil, err
+	}
+	return accept.NewListener(l, "auth", func(conn net.Conn) (net.Conn, error) {
+		if err := on.auth.Authorize(conn); err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}), nil
+}
+
+func authorize(auth Authorizer, conn net.Conn) (net.Conn, error) {
+	if err := auth.Authorize(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
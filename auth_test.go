@@ -0,0 +1,155 @@
+package onion
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var errRejected = errors.New("rejected")
+
+func TestAuthorizeConnect(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		err  error
+	}{
+		{name: "accepted"},
+		{name: "rejected", err: errRejected},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			dialer := newDialer("net")
+			o, err := New(dialer, newWrapper("enc"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var authorized []string
+			o = WithAuthorizer(o, AuthorizerFunc(func(conn net.Conn) error {
+				authorized = layerNames(conn)
+				return test.err
+			}))
+			conn, err := o.Connect("target:80", time.Second)
+			if err != test.err {
+				t.Fatalf("Connect error = %v, want %v", err, test.err)
+			}
+			if want := []string{"enc"}; !reflect.DeepEqual(authorized, want) {
+				t.Fatalf("authorized connection wrapped by %v, want %v", authorized, want)
+			}
+			peer := dialer.peers[0]
+			if err == nil {
+				conn.Close()
+				return
+			}
+			peer.SetReadDeadline(time.Now().Add(time.Second))
+			if _, err := peer.Read(make([]byte, 1)); err != io.EOF {
+				t.Fatalf("rejected connection was not closed, read error = %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthorizeListener(t *testing.T) {
+	o, err := New(newSource("net"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	o = WithAuthorizer(o, AuthorizerFunc(func(conn net.Conn) error {
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return err
+		}
+		if b[0] != 'y' {
+			return errRejected
+		}
+		return nil
+	}))
+	l, err := o.Listener(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	dial := func(b byte) net.Conn {
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		conn.Write([]byte{b})
+		return conn
+	}
+	rejected := dial('n')
+	defer rejected.Close()
+	if _, err := rejected.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("rejected connection was not closed, read error = %v", err)
+	}
+
+	accepted := dial('y')
+	defer accepted.Close()
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if conn.RemoteAddr().String() != accepted.LocalAddr().String() {
+		t.Fatalf("accepted %s, want %s", conn.RemoteAddr(), accepted.LocalAddr())
+	}
+}
+
+func TestAuthorizers(t *testing.T) {
+	var called []string
+	auth := func(name string, err error) Authorizer {
+		return AuthorizerFunc(func(net.Conn) error {
+			called = append(called, name)
+			return err
+		})
+	}
+	for _, test := range []struct {
+		name   string
+		auths  Authorizers
+		called []string
+		err    error
+	}{
+		{name: "empty"},
+		{name: "all", auths: Authorizers{auth("a", nil), auth("b", nil)}, called: []string{"a", "b"}},
+		{name: "first error", auths: Authorizers{auth("a", nil), auth("b", errRejected), auth("c", nil)}, called: []string{"a", "b"}, err: errRejected},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			called = nil
+			if err := test.auths.Authorize(nil); err != test.err {
+				t.Fatalf("Authorize error = %v, want %v", err, test.err)
+			}
+			if !reflect.DeepEqual(called, test.called) {
+				t.Fatalf("called %v, want %v", called, test.called)
+			}
+		})
+	}
+}
+
+func TestWalk(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	var conn net.Conn = c1
+	for _, name := range []string{"a", "b", "c"} {
+		conn = &testConn{Conn: conn, layer: name}
+	}
+	defer conn.Close()
+	if names, want := layerNames(conn), []string{"c", "b", "a"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("walked %v, want %v", names, want)
+	}
+
+	var walked int
+	Walk(conn, func(c net.Conn) bool {
+		walked++
+		return c.(*testConn).layer != "b"
+	})
+	if walked != 2 {
+		t.Fatalf("walked %d connections after returning false, want 2", walked)
+	}
+	Walk(nil, func(net.Conn) bool {
+		t.Fatal("walked nil connection")
+		return false
+	})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/forward"
+	"github.com/crackcomm/onion/layer/nacl"
+	"github.com/crackcomm/onion/layer/noise"
+	"github.com/crackcomm/onion/layer/sch"
+	"github.com/crackcomm/onion/layer/tls"
+	"github.com/crackcomm/onion/layer/tor"
+	"github.com/crackcomm/onion/socksserver"
+)
+
+// serve - Exposes a local service on the onion listener.
+func serve(args []string) error {
+	fs := newFlagSet("serve")
+	s := stackFlags(fs)
+	local := fs.String("local", "", "local service address")
+	o, err := parse(fs, s, args)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	if err := onion.ValidateListen(o); err != nil {
+		return err
+	}
+	if *local == "" {
+		fs.Usage()
+		return errors.New("local address is required")
+	}
+
+	l, err := o.Listener(nil)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", l.Addr())
+	return forward.ExposeListener(l, *local)
+}
+
+// connect - Connects stdin and stdout to an address through the onion.
+func connect(args []string) error {
+	fs := newFlagSet("connect")
+	s := stackFlags(fs)
+	timeout := fs.Duration("timeout", time.Minute, "connect timeout")
+	o, err := parse(fs, s, args)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	if err := onion.ValidateDial(o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("address is required")
+	}
+
+	conn, err := o.Connect(fs.Arg(0), *timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	received := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(os.Stdout, conn)
+		received <- err
+	}()
+	sent := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, os.Stdin)
+		sent <- err
+	}()
+
+	select {
+	case err := <-received:
+		return err
+	case err := <-sent:
+		if err != nil {
+			return err
+		}
+	}
+	// layers without half-close may fail instead of reading EOF
+	forward.CloseWrite(conn)
+	if err := <-received; err != nil {
+		glog.Warningf("[connect] %v", err)
+	}
+	return nil
+}
+
+// forwardCmd - Forwards a local port to an address through the onion.
+func forwardCmd(args []string) error {
+	fs := newFlagSet("forward")
+	s := stackFlags(fs)
+	local := fs.String("local", "127.0.0.1:8080", "local listen address")
+	o, err := parse(fs, s, args)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	if err := onion.ValidateDial(o); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("address is required")
+	}
+	return forward.Forward(*local, fs.Arg(0), o)
+}
+
+// socksCmd - Runs SOCKS5 server connecting through the onion.
+func socksCmd(args []string) error {
+	fs := newFlagSet("socks")
+	s := stackFlags(fs)
+	listen := fs.String("listen", "127.0.0.1:1080", "SOCKS5 listen address")
+	username := fs.String("username", "", "SOCKS5 username")
+	password := fs.String("password", "", "SOCKS5 password")
+	o, err := parse(fs, s, args)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	if err := onion.ValidateDial(o); err != nil {
+		return err
+	}
+
+	var opts []socksserver.Option
+	if *username != "" {
+		opts = append(opts, socksserver.WithUsers(map[string]string{*username: *password}))
+	}
+	fmt.Fprintf(os.Stderr, "Listening on %s\n", *listen)
+	return socksserver.NewServer(o, opts...).ListenAndServe(*listen)
+}
+
+// keygen - Generates tls, sch or tor key files
+// or prints base64 noise and nacl keys used in configs.
+func keygen(args []string) error {
+	fs := newFlagSet("keygen")
+	typ := fs.String("type", "", "key type: tls, sch, tor, noise or nacl")
+	out := fs.String("out", "", "output file name without extension (default: key type), noise and nacl keys are printed")
+	host := fs.String("host", "", "tls certificate host name or IP address")
+	fs.Parse(args)
+
+	name := *out
+	if name == "" {
+		name = *typ
+	}
+	switch *typ {
+	case "tls":
+		var hosts []string
+		if *host != "" {
+			hosts = append(hosts, *host)
+		}
+		cert, key, err := tls.GenerateCert(hosts...)
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(name+".crt", cert, 0644); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(name+".key", key, 0600); err != nil {
+			return err
+		}
+		fp := sha256.Sum256(cert)
+		fmt.Printf("Written %s.crt and %s.key (%s)\n", name, name, tls.FormatFingerprint(fp))
+	case "sch":
+		pub, priv, err := sch.GenerateKey(nil)
+		if err != nil {
+			return err
+		}
+		if err := sch.WritePublicKeyFile(name+".pub", pub); err != nil {
+			return err
+		}
+		if err := sch.WritePrivateKeyFile(name+".key", priv); err != nil {
+			return err
+		}
+		fmt.Printf("Written %s.pub and %s.key\n", name, name)
+	case "tor":
+		key, id, err := tor.GenerateKey(nil)
+		if err != nil {
+			return err
+		}
+		if err := tor.WriteKeyFile(name+".key", key); err != nil {
+			return err
+		}
+		fmt.Printf("Written %s.key of %s.onion\n", name, id)
+	case "noise", "nacl":
+		generate := noise.GenerateKey
+		if *typ == "nacl" {
+			generate = nacl.GenerateKey
+		}
+		pub, priv, err := generate(nil)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("private_key: %s\n", base64.StdEncoding.EncodeToString(priv[:]))
+		fmt.Printf("# public key for peers: %s\n", base64.StdEncoding.EncodeToString(pub[:]))
+	default:
+		fs.Usage()
+		return fmt.Errorf("unknown key type %q", *typ)
+	}
+	return nil
+}
+
+// layers - Lists registered layers with their parameters.
+func layers(args []string) error {
+	fs := newFlagSet("layers")
+	fs.Parse(args)
+	names := onion.Registered()
+	if fs.NArg() > 0 {
+		names = fs.Args()
+	}
+
+	infos := make([]*onion.LayerInfo, len(names))
+	for i, name := range names {
+		info, ok := onion.Lookup(name)
+		if !ok {
+			return fmt.Errorf("unknown layer %q", name)
+		}
+		infos[i] = info
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, info := range infos {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", info.Name, strings.Join(info.Roles(), ","), info.Description)
+		for _, param := range info.Params {
+			description := param.Description
+			if param.Required {
+				description += " (required)"
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\n", param.Name, param.Type, description)
+		}
+	}
+	return w.Flush()
+}
+
+// describe - Prints dial and listen paths of the onion without connecting.
+func describe(args []string) error {
+	fs := newFlagSet("describe")
+	s := stackFlags(fs)
+	o, err := parse(fs, s, args)
+	if err != nil {
+		return err
+	}
+	defer o.Close()
+	fmt.Println(o.Describe())
+	return nil
+}
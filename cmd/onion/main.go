@@ -0,0 +1,94 @@
+// Command onion connects and exposes services through an onion.
+//
+// Usage:
+//
+//	onion [glog flags] <command> [flags] [arguments]
+//
+// Commands:
+//
+//	serve    exposes a local service on the onion listener
+//	connect  connects stdin and stdout to an address through the onion
+//	forward  forwards a local port to an address through the onion
+//	socks    runs SOCKS5 server connecting through the onion
+//	keygen   generates tls, sch, tor, noise or nacl keys
+//	layers   lists layers available in config files and specs
+//	describe prints dial and listen paths of the onion
+//
+// Layer stack is described with flags, see "onion <command> -h",
+// or with a YAML or JSON onion config file.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/golang/glog"
+)
+
+// command - Subcommand of the tool.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"serve", "serve [flags] -local host:port", serve},
+		{"connect", "connect [flags] address", connect},
+		{"forward", "forward [flags] -local host:port address", forwardCmd},
+		{"socks", "socks [flags]", socksCmd},
+		{"keygen", "keygen -type tls|sch|tor|noise|nacl [-out name]", keygen},
+		{"layers", "layers [name...]", layers},
+		{"describe", "describe [flags]", describe},
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	defer glog.Flush()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+	for _, cmd := range commands {
+		if cmd.name == flag.Arg(0) {
+			if err := cmd.run(flag.Args()[1:]); err != nil {
+				glog.Flush()
+				fmt.Fprintf(os.Stderr, "onion %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "onion: unknown command %q\n", flag.Arg(0))
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: onion [glog flags] <command> [flags] [arguments]\n\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  onion %s\n", cmd.usage)
+	}
+}
+
+// newFlagSet - Returns flag set of a command.
+func newFlagSet(name string) *flag.FlagSet {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			fs := flag.NewFlagSet(name, flag.ExitOnError)
+			fs.Usage = func() {
+				fmt.Fprintf(os.Stderr, "Usage: onion %s\n", cmd.usage)
+				fs.PrintDefaults()
+			}
+			return fs
+		}
+	}
+	panic("unknown command " + name)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/crackcomm/onion"
+	_ "github.com/crackcomm/onion/layer/compress"
+	_ "github.com/crackcomm/onion/layer/httpproxy"
+	_ "github.com/crackcomm/onion/layer/jwt"
+	_ "github.com/crackcomm/onion/layer/mux"
+	_ "github.com/crackcomm/onion/layer/nacl"
+	netlayer "github.com/crackcomm/onion/layer/net"
+	_ "github.com/crackcomm/onion/layer/noise"
+	_ "github.com/crackcomm/onion/layer/pad"
+	_ "github.com/crackcomm/onion/layer/pake"
+	_ "github.com/crackcomm/onion/layer/psk"
+	"github.com/crackcomm/onion/layer/sch"
+	_ "github.com/crackcomm/onion/layer/socks"
+	"github.com/crackcomm/onion/layer/tls"
+	"github.com/crackcomm/onion/layer/tor"
+	_ "github.com/crackcomm/onion/layer/ws"
+)
+
+// stack - Layer stack options set with flags.
+// Layers are net, tor unless direct, tls if certificate is set
+// and sch if keys are set. Config file or spec replaces the flags.
+type stack struct {
+	config string
+	spec   string
+
+	direct     bool
+	netAddress string
+	netPort    int
+
+	torBin     string
+	torProxy   string
+	torPort    uint
+	torKey     string
+	torVerbose bool
+
+	tlsCert     string
+	tlsKey      string
+	tlsInsecure bool
+
+	schPubKey  string
+	schPrivKey string
+}
+
+// stackFlags - Registers layer stack flags.
+func stackFlags(fs *flag.FlagSet) *stack {
+	s := new(stack)
+	fs.StringVar(&s.config, "config", "", "YAML or JSON onion config file (replaces layer flags)")
+	fs.StringVar(&s.spec, "spec", "", "onion spec, e.g. net+tor(port=80)+sch(keys=root) (replaces layer flags)")
+	fs.BoolVar(&s.direct, "direct", false, "dial directly instead of through tor")
+	fs.StringVar(&s.netAddress, "net-address", "127.0.0.1", "local listener address")
+	fs.IntVar(&s.netPort, "net-port", 0, "local listener port")
+	fs.StringVar(&s.torBin, "tor-bin", "/usr/local/bin/tor", "tor binary")
+	fs.StringVar(&s.torProxy, "tor-proxy", "", "tor proxy address (socks5)")
+	fs.UintVar(&s.torPort, "tor-port", 0, "onion service port")
+	fs.StringVar(&s.torKey, "tor-key", "", "onion service key file")
+	fs.BoolVar(&s.torVerbose, "tor-verbose", false, "verbose tor")
+	fs.StringVar(&s.tlsCert, "tls-cert", "", "tls certificate file")
+	fs.StringVar(&s.tlsKey, "tls-key", "", "tls private key file")
+	fs.BoolVar(&s.tlsInsecure, "tls-insecure", false, "skip tls certificate verification")
+	fs.StringVar(&s.schPubKey, "sch-pub-key", "", "schannel public key file")
+	fs.StringVar(&s.schPrivKey, "sch-priv-key", "", "schannel private key file")
+	return s
+}
+
+// onion - Creates an onion from the config file or spec if set
+// or from the stack flags.
+func (s *stack) onion() (onion.Onion, error) {
+	if s.spec != "" {
+		return onion.FromSpec(s.spec)
+	}
+	if s.config != "" {
+		config, err := onion.LoadConfig(s.config)
+		if err != nil {
+			return nil, err
+		}
+		return onion.FromConfig(config)
+	}
+
+	netOpts := []netlayer.Option{
+		netlayer.WithAddress(s.netAddress),
+		netlayer.WithPort(s.netPort),
+	}
+	if s.direct {
+		netOpts = append(netOpts, netlayer.WithDial())
+	}
+	layers := []onion.Layer{netlayer.NewLayer(netOpts...)}
+
+	if !s.direct {
+		torOpts := []tor.Option{
+			tor.WithBin(s.torBin),
+			tor.WithProxy(s.torProxy),
+			tor.WithPort(uint16(s.torPort)),
+			tor.WithVerbose(s.torVerbose),
+		}
+		if s.torKey != "" {
+			key, err := tor.ReadKeyFile(s.torKey)
+			if err != nil {
+				return nil, err
+			}
+			torOpts = append(torOpts, tor.WithKey(key))
+		}
+		layers = append(layers, tor.NewLayer(torOpts...))
+	}
+
+	if s.tlsCert != "" {
+		cert, err := tls.LoadCertAndKeyFile(s.tlsCert, s.tlsKey)
+		if err != nil {
+			return nil, err
+		}
+		tlsOpts := []tls.Option{cert}
+		if s.tlsInsecure {
+			tlsOpts = append(tlsOpts, tls.WithInsecure())
+		}
+		layers = append(layers, tls.NewLayer(tlsOpts...))
+	}
+
+	if s.schPubKey != "" || s.schPrivKey != "" {
+		keys, err := sch.WithKeyFiles(s.schPubKey, s.schPrivKey)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, sch.NewLayer(keys))
+	}
+
+	return onion.New(layers...)
+}
+
+// parse - Parses command flags and creates an onion.
+func parse(fs *flag.FlagSet, s *stack, args []string) (onion.Onion, error) {
+	fs.Parse(args)
+	return s.onion()
+}
@@ -0,0 +1,61 @@
+// Command socks runs SOCKS5 server dialing through TOR
+// and optionally through a Schannel layer.
+package main
+
+import (
+	"flag"
+
+	"github.com/golang/glog"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/layer/sch"
+	"github.com/crackcomm/onion/layer/tor"
+	"github.com/crackcomm/onion/socksserver"
+)
+
+var (
+	listen   = flag.String("listen", "127.0.0.1:1080", "SOCKS5 listen address")
+	torProxy = flag.String("proxy", "", "proxy address (socks5)")
+	torBin   = flag.String("tor-bin", "/usr/local/bin/tor", "Tor binary")
+	pubKey   = flag.String("pub-key", "", "schannel public key")
+	privKey  = flag.String("priv-key", "", "schannel private key")
+	username = flag.String("username", "", "SOCKS5 username")
+	password = flag.String("password", "", "SOCKS5 password")
+	verbose  = flag.Bool("verbose", false, "verbose tor")
+)
+
+func main() {
+	defer glog.Flush()
+	flag.Parse()
+
+	layers := []onion.Layer{
+		tor.NewLayer(
+			tor.WithBin(*torBin),
+			tor.WithVerbose(*verbose),
+			tor.WithProxy(*torProxy),
+		),
+	}
+	if *pubKey != "" || *privKey != "" {
+		keys, err := sch.WithKeyFiles(*pubKey, *privKey)
+		if err != nil {
+			glog.Fatal(err)
+		}
+		layers = append(layers, sch.NewLayer(keys))
+	}
+
+	o, err := onion.New(layers...)
+	if err != nil {
+		glog.Fatal(err)
+	}
+	defer o.Close()
+
+	var opts []socksserver.Option
+	if *username != "" {
+		opts = append(opts, socksserver.WithUsers(map[string]string{*username: *password}))
+	}
+
+	glog.Infof("Listening on %s", *listen)
+	if err := socksserver.NewServer(o, opts...).ListenAndServe(*listen); err != nil {
+		glog.Fatal(err)
+	}
+}
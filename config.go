@@ -0,0 +1,123 @@
+package onion
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config - Onion configuration.
+//
+// Layers are listed in the same order as in New, for example:
+//
+//	layers:
+//	  - name: net
+//	  - name: tor
+//	    params:
+//	      port: 80
+//	  - name: sch
+//	    params:
+//	      keys: /etc/onion/root
+type Config struct {
+	Layers []*LayerConfig `json:"layers" yaml:"layers"`
+}
+
+// LayerConfig - Layer configuration.
+type LayerConfig struct {
+	// Name - Name of the registered layer factory.
+	Name string `json:"name" yaml:"name"`
+
+	// Params - Layer parameters passed to the factory.
+	Params Params `json:"params,omitempty" yaml:"params,omitempty"`
+}
+
+// Params - Layer parameters.
+type Params map[string]interface{}
+
+// Decode - Decodes parameters into a struct with yaml field tags.
+// Unknown parameters are an error.
+func (params Params) Decode(v interface{}) error {
+	body, err := yaml.Marshal(map[string]interface{}(params))
+	if err != nil {
+		return err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(body))
+	dec.KnownFields(true)
+	return dec.Decode(v)
+}
+
+// Strings - Parameter accepting a string or a list of strings.
+type Strings []string
+
+// UnmarshalYAML - Decodes a string or a list of strings.
+func (s *Strings) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = Strings{node.Value}
+		return nil
+	}
+	return node.Decode((*[]string)(s))
+}
+
+// FromConfig - Creates an onion from configuration.
+// Created layers are closed if one of them can't be created
+// or the onion is invalid.
+func FromConfig(config *Config) (Onion, error) {
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	layers := make([]Layer, 0, len(config.Layers))
+	closeLayers := func() {
+		for _, l := range layers {
+			l.Close()
+		}
+	}
+	for _, lc := range config.Layers {
+		layer, err := NewLayer(lc.Name, lc.Params)
+		if err != nil {
+			closeLayers()
+			return nil, err
+		}
+		layers = append(layers, layer)
+	}
+	o, err := New(layers...)
+	if err != nil {
+		closeLayers()
+		return nil, err
+	}
+	return o, nil
+}
+
+// validate - Returns an error if one of layer entries is empty.
+func (config *Config) validate() error {
+	for index, lc := range config.Layers {
+		if lc == nil || lc.Name == "" {
+			return fmt.Errorf("onion: config: layer %d is empty", index)
+		}
+	}
+	return nil
+}
+
+// ParseConfig - Parses YAML or JSON configuration.
+func ParseConfig(body []byte) (*Config, error) {
+	config := new(Config)
+	dec := yaml.NewDecoder(bytes.NewReader(body))
+	dec.KnownFields(true)
+	if err := dec.Decode(config); err != nil {
+		return nil, fmt.Errorf("onion: config: %v", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// LoadConfig - Reads YAML or JSON configuration file.
+func LoadConfig(filename string) (*Config, error) {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(body)
+}
@@ -0,0 +1,234 @@
+package onion
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	want := &Config{Layers: []*LayerConfig{
+		{Name: "net"},
+		{Name: "tor", Params: Params{"port": 80}},
+		{Name: "sch", Params: Params{"keys": "/etc/onion/root"}},
+	}}
+	for _, test := range []struct {
+		name string
+		body string
+	}{
+		{
+			name: "yaml",
+			body: `
+layers:
+  - name: net
+  - name: tor
+    params:
+      port: 80
+  - name: sch
+    params:
+      keys: /etc/onion/root
+`,
+		},
+		{
+			name: "json",
+			body: `{"layers": [{"name": "net"}, {"name": "tor", "params": {"port": 80}}, {"name": "sch", "params": {"keys": "/etc/onion/root"}}]}`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := ParseConfig([]byte(test.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(config, want) {
+				t.Fatalf("config = %s, want %s", config.Spec(), want.Spec())
+			}
+		})
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		body string
+		err  string
+	}{
+		{name: "unknown field", body: "layers:\n  - name: net\n    parmas: {}\n"},
+		{name: "unknown top field", body: "layer: []\n"},
+		{name: "layers type", body: "layers: net\n"},
+		{name: "malformed", body: `{"layers": [`},
+		{name: "null layer", body: "layers: [~]\n", err: "onion: config: layer 0 is empty"},
+		{name: "empty layer", body: "layers:\n  - name: net\n  -\n", err: "onion: config: layer 1 is empty"},
+		{name: "no name", body: "layers:\n  - params: {port: 80}\n", err: "onion: config: layer 0 is empty"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseConfig([]byte(test.body))
+			if err == nil || !strings.HasPrefix(err.Error(), "onion: config: ") {
+				t.Fatalf("ParseConfig error = %v", err)
+			}
+			if test.err != "" && err.Error() != test.err {
+				t.Fatalf("ParseConfig error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "onion.yaml")
+	if _, err := LoadConfig(filename); !os.IsNotExist(err) {
+		t.Fatalf("LoadConfig error = %v, want not exist", err)
+	}
+	if err := ioutil.WriteFile(filename, []byte("layers:\n  - name: test-net\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config, err := LoadConfig(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spec := config.Spec(); spec != "test-net" {
+		t.Fatalf("config spec = %q, want test-net", spec)
+	}
+}
+
+func TestParamsDecode(t *testing.T) {
+	ratio := 0.5
+	for _, test := range []struct {
+		name   string
+		params Params
+		want   testParams
+		err    bool
+	}{
+		{
+			name:   "scalars",
+			params: Params{"secret": "s", "port": 80, "timeout": "1m", "ratio": 0.5, "fail": true},
+			want:   testParams{Secret: "s", Port: 80, Timeout: time.Minute, Ratio: &ratio, Fail: true},
+		},
+		{
+			name:   "string",
+			params: Params{"peers": "key"},
+			want:   testParams{Peers: Strings{"key"}},
+		},
+		{
+			name:   "list",
+			params: Params{"peers": []interface{}{"a", "b"}, "sizes": []interface{}{128, 512}},
+			want:   testParams{Peers: Strings{"a", "b"}, Sizes: []int{128, 512}},
+		},
+		{
+			name:   "map",
+			params: Params{"headers": map[string]interface{}{"Host": "example.com"}},
+			want:   testParams{Headers: map[string]string{"Host": "example.com"}},
+		},
+		{name: "nil", params: nil},
+		{name: "unknown", params: Params{"secrets": "s"}, err: true},
+		{name: "ignored", params: Params{"Ignored": "s"}, err: true},
+		{name: "type", params: Params{"port": "http"}, err: true},
+		{name: "list type", params: Params{"peers": map[string]interface{}{"a": "b"}}, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var got testParams
+			err := test.params.Decode(&got)
+			if (err != nil) != test.err {
+				t.Fatalf("Decode error = %v, want error %t", err, test.err)
+			}
+			if err == nil && !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("decoded %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+// testCreated - Layers created by test-source factory.
+var testCreated []*testSource
+
+func init() {
+	Register("test-source", func(p Params) (Layer, error) {
+		layer := newSource("test-source")
+		testCreated = append(testCreated, layer)
+		return layer, nil
+	}, LayerInfo{
+		Description: "Test listener source recording created layers",
+		Layer:       (*testSource)(nil),
+	})
+}
+
+func TestFromConfig(t *testing.T) {
+	o, err := FromConfig(&Config{Layers: []*LayerConfig{
+		{Name: "test-net"},
+		{Name: "test-proxy", Params: Params{"proxy": "proxy:1080"}},
+		{Name: "test-enc", Params: Params{"secret": "s"}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if desc, want := o.Describe().String(), "dial: test-net dial => test-proxy dial through => test-enc wrap\nlisten: test-net listen => test-enc wrap listener"; desc != want {
+		t.Fatalf("description:\n%s\nwant:\n%s", desc, want)
+	}
+}
+
+func TestFromConfigErrors(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		layers  []*LayerConfig
+		err     string
+		created int
+	}{
+		{
+			name:    "unknown layer",
+			layers:  []*LayerConfig{{Name: "test-source"}, {Name: "test-unknown"}},
+			err:     `onion: unknown layer "test-unknown"`,
+			created: 1,
+		},
+		{
+			name:    "factory error",
+			layers:  []*LayerConfig{{Name: "test-source"}, {Name: "test-enc", Params: Params{"secret": "s", "fail": true}}},
+			err:     "onion: layer test-enc: failed",
+			created: 1,
+		},
+		{
+			name:    "params",
+			layers:  []*LayerConfig{{Name: "test-source"}, {Name: "test-enc"}},
+			err:     `onion: layer test-enc: missing required parameter "secret"`,
+			created: 1,
+		},
+		{
+			name:    "order",
+			layers:  []*LayerConfig{{Name: "test-enc", Params: Params{"secret": "s"}}, {Name: "test-source"}},
+			err:     "onion: listener source test-source follows test-enc wrapping listeners",
+			created: 1,
+		},
+		{
+			name: "no layers",
+			err:  "onion: no layers",
+		},
+		{
+			name:   "nil layer",
+			layers: []*LayerConfig{{Name: "test-source"}, nil},
+			err:    "onion: config: layer 1 is empty",
+		},
+		{
+			name:   "empty name",
+			layers: []*LayerConfig{{Name: "test-source"}, {Params: Params{"secret": "s"}}},
+			err:    "onion: config: layer 1 is empty",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			testCreated = nil
+			_, err := FromConfig(&Config{Layers: test.layers})
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Fatalf("FromConfig error = %v, want %q", err, test.err)
+			}
+			for _, layer := range testCreated {
+				if !layer.closed {
+					t.Errorf("layer %s was not closed", layer.name)
+				}
+			}
+			if len(testCreated) != test.created {
+				t.Errorf("created %d test-source layers, want %d", len(testCreated), test.created)
+			}
+		})
+	}
+}
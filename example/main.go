@@ -3,9 +3,7 @@ package main
 import (
 	"bufio"
 	"flag"
-	"io"
 	"net"
-	"os"
 	"time"
 
 	"github.com/golang/glog"
@@ -24,6 +22,7 @@ var (
 	pubKey   = flag.String("pub-key", "root.pub", "public key")
 	privKey  = flag.String("priv-key", "root.key", "private key")
 	verbose  = flag.Bool("verbose", false, "verbose tor")
+	keygen   = flag.Bool("keygen", false, "generate schannel key pair")
 )
 
 func main() {
@@ -34,10 +33,22 @@ func main() {
 		glog.Fatal("Tor-bin empty")
 	}
 
+	if *keygen {
+		if err := generateKeys(); err != nil {
+			glog.Fatal(err)
+		}
+		return
+	}
+
+	keys, err := sch.WithKeyFiles(*pubKey, *privKey)
+	if err != nil {
+		glog.Fatal(err)
+	}
+
 	glog.Info("start")
 
 	// Create an onion
-	o := onion.New(
+	o, err := onion.New(
 		netlayer.NewLayer(),
 		tor.NewLayer(
 			tor.WithBin(*torBin),
@@ -45,23 +56,17 @@ func main() {
 			tor.WithVerbose(*verbose),
 			tor.WithProxy(*torProxy),
 		),
-		sch.NewLayer(
-			sch.WithPubKey(readPubKey()),
-			sch.WithPrivKey(readPrivKey()),
-		),
+		sch.NewLayer(keys),
 		tls.NewLayer(
 			tls.WithInsecure(),
 			tls.WithCertAndKeyFile("ca.pem", "ca.key"),
 		),
-		sch.NewLayer(
-			sch.WithPubKey(readPubKey()),
-			sch.WithPrivKey(readPrivKey()),
-		),
-		sch.NewLayer(
-			sch.WithPubKey(readPubKey()),
-			sch.WithPrivKey(readPrivKey()),
-		),
+		sch.NewLayer(keys),
+		sch.NewLayer(keys),
 	)
+	if err != nil {
+		glog.Fatal(err)
+	}
 	defer o.Close()
 
 	if *client {
@@ -120,28 +125,13 @@ func serve(conn net.Conn) {
 
 }
 
-func readPubKey() (key *[32]byte) {
-	f, err := os.Open(*pubKey)
+func generateKeys() error {
+	pub, priv, err := sch.GenerateKey(nil)
 	if err != nil {
-		glog.Fatal(err)
+		return err
 	}
-	key = new([32]byte)
-	_, err = io.ReadFull(f, key[:])
-	if err != nil {
-		glog.Fatal(err)
-	}
-	return
-}
-
-func readPrivKey() (key *[64]byte) {
-	f, err := os.Open(*privKey)
-	if err != nil {
-		glog.Fatal(err)
-	}
-	key = new([64]byte)
-	_, err = io.ReadFull(f, key[:])
-	if err != nil {
-		glog.Fatal(err)
+	if err := sch.WritePublicKeyFile(*pubKey, pub); err != nil {
+		return err
 	}
-	return
+	return sch.WritePrivateKeyFile(*privKey, priv)
 }
@@ -0,0 +1,136 @@
+// Package forward implements port forwarding through an onion.
+//
+// Forward listens locally and connects clients to a remote address
+// through an onion. Expose accepts connections on an onion listener
+// and connects them to a local service.
+package forward
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
+)
+
+// DialTimeout - Timeout of connecting to the other side.
+var DialTimeout = time.Minute
+
+// Forward - Listens on local address and forwards connections
+// to remote address through the onion.
+func Forward(localAddr, remoteAddr string, o onion.Onion) error {
+	l, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	glog.Infof("[forward] %s => %s", l.Addr(), remoteAddr)
+	return ForwardListener(l, remoteAddr, o)
+}
+
+// ForwardListener - Forwards connections accepted from listener
+// to remote address through the onion. It returns when listener is closed.
+func ForwardListener(l net.Listener, remoteAddr string, o onion.Onion) error {
+	return serve(l, func() (net.Conn, error) {
+		return o.Connect(remoteAddr, DialTimeout)
+	})
+}
+
+// Expose - Accepts connections on the onion listener
+// and forwards them to a local TCP service.
+func Expose(o onion.Onion, localService string) error {
+	l, err := o.Listener(nil)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	glog.Infof("[forward] %s => %s", l.Addr(), localService)
+	return ExposeListener(l, localService)
+}
+
+// ExposeListener - Forwards connections accepted from the onion listener
+// to a local TCP service. It returns when listener is closed.
+func ExposeListener(l net.Listener, localService string) error {
+	return serve(l, func() (net.Conn, error) {
+		return net.DialTimeout("tcp", localService, DialTimeout)
+	})
+}
+
+// serve - Connects accepted connections to dialed ones.
+// Failed accepts are logged and retried with a backoff like in net/http,
+// for example when running out of file descriptors.
+func serve(l net.Listener, dial func() (net.Conn, error)) error {
+	var backoff accept.Backoff
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if err := backoff.Retry("forward", err); err != nil {
+				return err
+			}
+			continue
+		}
+		backoff.Reset()
+		go handle(conn, dial)
+	}
+}
+
+func handle(conn net.Conn, dial func() (net.Conn, error)) {
+	defer conn.Close()
+	target, err := dial()
+	if err != nil {
+		glog.Warningf("[forward] %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	defer target.Close()
+
+	glog.Infof("[forward] %s => %s", conn.RemoteAddr(), target.RemoteAddr())
+	sent, received := Pipe(conn, target)
+	glog.Infof("[forward] %s closed (sent %d, received %d bytes)", conn.RemoteAddr(), sent, received)
+}
+
+// Pipe - Copies data between connections until both directions are finished.
+// When one direction reaches EOF write side of its destination is closed
+// if it supports CloseWrite, otherwise the connection is closed.
+// When one direction fails both connections are closed, so the other
+// direction doesn't block forever.
+// Returns number of bytes copied from a to b and from b to a.
+func Pipe(a, b net.Conn) (ab, ba int64) {
+	wg := new(sync.WaitGroup)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ab = copyAndClose(b, a)
+	}()
+	go func() {
+		defer wg.Done()
+		ba = copyAndClose(a, b)
+	}()
+	wg.Wait()
+	return
+}
+
+func copyAndClose(dst, src net.Conn) int64 {
+	n, err := io.Copy(dst, src)
+	if err != nil {
+		glog.V(2).Infof("[forward] %s => %s: %v", src.RemoteAddr(), dst.RemoteAddr(), err)
+		dst.Close()
+		src.Close()
+		return n
+	}
+	CloseWrite(dst)
+	return n
+}
+
+// CloseWrite - Closes write side of the connection if it supports CloseWrite,
+// otherwise closes the connection. Only the outermost connection is used,
+// onion layers close their write side with their own close messages.
+func CloseWrite(conn net.Conn) error {
+	if err := onion.CloseWrite(conn); err == nil {
+		return nil
+	}
+	return conn.Close()
+}
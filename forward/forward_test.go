@@ -0,0 +1,206 @@
+package forward
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/layer/compress"
+	netlayer "github.com/crackcomm/onion/layer/net"
+	"github.com/crackcomm/onion/layer/psk"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+// service - Returns address of a service replying to the whole request
+// after reading it until EOF, so it works only if half-close is forwarded.
+func service(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				b, _ := ioutil.ReadAll(conn)
+				conn.Write(append([]byte("reply: "), b...))
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func listen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestForward(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		layers func() []onion.Layer
+	}{
+		{name: "net", layers: func() []onion.Layer { return nil }},
+		{name: "psk", layers: func() []onion.Layer {
+			return []onion.Layer{psk.NewLayer(psk.WithSecret(secret))}
+		}},
+		{name: "zstd", layers: func() []onion.Layer {
+			return []onion.Layer{compress.NewLayer(compress.WithAlgorithms(compress.Zstd))}
+		}},
+		{name: "psk+zstd", layers: func() []onion.Layer {
+			return []onion.Layer{psk.NewLayer(psk.WithSecret(secret)), compress.NewLayer(compress.WithAlgorithms(compress.Zstd))}
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server, err := onion.New(append([]onion.Layer{netlayer.NewLayer()}, test.layers()...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			exposed, err := server.Listener(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exposed.Close()
+			go ExposeListener(exposed, service(t))
+
+			client, err := onion.New(append([]onion.Layer{netlayer.NewLayer(netlayer.WithDial())}, test.layers()...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			local := listen(t)
+			go ForwardListener(local, exposed.Addr().String(), client)
+
+			conn, err := net.Dial("tcp", local.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if _, err := conn.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(conn)
+			if err != nil || string(b) != "reply: hello" {
+				t.Fatalf("read %q, %v, want %q", b, err, "reply: hello")
+			}
+		})
+	}
+}
+
+// flakyListener - Listener failing first accepts.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, errors.New("too many open files")
+	}
+	return l.Listener.Accept()
+}
+
+func TestServeAcceptErrors(t *testing.T) {
+	l := &flakyListener{Listener: listen(t), failures: 3}
+	done := make(chan error, 1)
+	go func() {
+		done <- ExposeListener(l, service(t))
+	}()
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("hello"))
+	conn.(*net.TCPConn).CloseWrite()
+	if b, err := ioutil.ReadAll(conn); err != nil || string(b) != "reply: hello" {
+		t.Fatalf("read %q, %v, want %q", b, err, "reply: hello")
+	}
+
+	l.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("serve error = %v, want %v", err, net.ErrClosed)
+	}
+}
+
+// tcpPair - Returns both ends of a local TCP connection.
+func tcpPair(t *testing.T) (*net.TCPConn, net.Conn) {
+	l := listen(t)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		peer.Close()
+	})
+	return conn.(*net.TCPConn), peer
+}
+
+func TestPipeReset(t *testing.T) {
+	client, a := tcpPair(t)
+	b, service := tcpPair(t)
+	done := make(chan int64, 1)
+	go func() {
+		ab, _ := Pipe(a, b)
+		done <- ab
+	}()
+
+	if _, err := client.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	service.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(service, make([]byte, 5)); err != nil {
+		t.Fatal(err)
+	}
+	// service never replies nor closes, reset client connection mid-stream
+	client.SetLinger(0)
+	client.Close()
+
+	select {
+	case ab := <-done:
+		if ab != 5 {
+			t.Fatalf("copied %d bytes, want 5", ab)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Pipe did not return after connection reset")
+	}
+	if _, err := io.ReadFull(service, make([]byte, 1)); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("service connection was not closed, read error = %v", err)
+	}
+}
+
+func TestCloseWrite(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	go c2.Write([]byte("hello"))
+	if err := CloseWrite(c1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c1.Read(make([]byte, 1)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("read after CloseWrite of connection without half-close = %v, want %v", err, io.ErrClosedPipe)
+	}
+}
@@ -0,0 +1,108 @@
+// Package accept implements listeners running handshakes of accepted
+// connections concurrently, so one slow peer doesn't block accepting others.
+package accept
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Timeout - Time limit of a handshake of an accepted connection.
+const Timeout = 30 * time.Second
+
+// Handshake - Performs a handshake on an accepted connection
+// and returns the connection wrapped by the layer.
+type Handshake func(net.Conn) (net.Conn, error)
+
+// Listener - Listener returning connections which completed a handshake.
+// Connections failing the handshake are logged and closed.
+type Listener struct {
+	net.Listener
+	name      string
+	handshake Handshake
+
+	conns  chan net.Conn
+	errs   chan error
+	once   *sync.Once
+	closed chan struct{}
+}
+
+// NewListener - Creates a listener and starts accepting connections.
+// Name is used as a prefix of log messages.
+func NewListener(l net.Listener, name string, handshake Handshake) *Listener {
+	ln := &Listener{
+		Listener:  l,
+		name:      name,
+		handshake: handshake,
+		conns:     make(chan net.Conn),
+		errs:      make(chan error),
+		once:      new(sync.Once),
+		closed:    make(chan struct{}),
+	}
+	go ln.acceptLoop()
+	return ln
+}
+
+// Accept - Returns next connection which completed a handshake.
+// Errors of the underlying listener are returned too.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close - Closes the listener.
+// Connections finishing a handshake after Close are closed.
+func (l *Listener) Close() (err error) {
+	err = net.ErrClosed
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.Listener.Close()
+	})
+	return
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.closed:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				l.Close()
+				return
+			}
+			continue
+		}
+		go l.serve(conn)
+	}
+}
+
+// serve - Performs a handshake with a deadline.
+func (l *Listener) serve(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(Timeout))
+	c, err := l.handshake(conn)
+	if err != nil {
+		glog.Warningf("[%s] reject %s: %v", l.name, conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+	select {
+	case l.conns <- c:
+	case <-l.closed:
+		c.Close()
+	}
+}
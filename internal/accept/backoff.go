@@ -0,0 +1,47 @@
+package accept
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	minDelay = 5 * time.Millisecond
+	maxDelay = time.Second
+)
+
+// Backoff - Delay of retrying failed accepts like in net/http,
+// for example when running out of file descriptors.
+// Delay starts at 5ms and doubles up to 1s.
+type Backoff struct {
+	delay time.Duration
+}
+
+// Retry - Returns the error if listener was closed, otherwise
+// logs it and sleeps before next accept. Name is a log prefix.
+func (b *Backoff) Retry(name string, err error) error {
+	if errors.Is(err, net.ErrClosed) {
+		return err
+	}
+	delay := b.next()
+	glog.Warningf("[%s] accept error: %v; retrying in %v", name, err, delay)
+	time.Sleep(delay)
+	return nil
+}
+
+// Reset - Resets the delay after a successful accept.
+func (b *Backoff) Reset() {
+	b.delay = 0
+}
+
+func (b *Backoff) next() time.Duration {
+	if b.delay == 0 {
+		b.delay = minDelay
+	} else if b.delay *= 2; b.delay > maxDelay {
+		b.delay = maxDelay
+	}
+	return b.delay
+}
@@ -0,0 +1,44 @@
+package accept
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	var b Backoff
+	for i, want := range []time.Duration{
+		5 * time.Millisecond,
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		80 * time.Millisecond,
+		160 * time.Millisecond,
+		320 * time.Millisecond,
+		640 * time.Millisecond,
+		time.Second,
+		time.Second,
+	} {
+		if delay := b.next(); delay != want {
+			t.Fatalf("delay %d = %v, want %v", i, delay, want)
+		}
+	}
+	b.Reset()
+	if delay := b.next(); delay != minDelay {
+		t.Fatalf("delay after Reset = %v, want %v", delay, minDelay)
+	}
+}
+
+func TestBackoffClosed(t *testing.T) {
+	var b Backoff
+	err := fmt.Errorf("accept: %w", net.ErrClosed)
+	if got := b.Retry("test", err); got != err {
+		t.Fatalf("Retry error = %v, want %v", got, err)
+	}
+	if got := b.Retry("test", errors.New("too many open files")); got != nil {
+		t.Fatalf("Retry error = %v, want nil", got)
+	}
+}
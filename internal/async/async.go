@@ -0,0 +1,364 @@
+// Package async implements connections that receive and send messages
+// on separate goroutines, so deadlines never interrupt a message
+// in the middle and the stream stays usable after a timeout.
+package async
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// shutdownTimeout - Time limit for Shutdown on Close.
+const shutdownTimeout = time.Second
+
+var (
+	// ErrCloseWrite - Stream doesn't implement CloseWriter.
+	ErrCloseWrite = errors.New("async: stream does not support CloseWrite")
+
+	// ErrWriteClosed - Write side of the connection was closed with CloseWrite.
+	ErrWriteClosed = errors.New("async: write side closed")
+)
+
+// Stream - Message stream over a connection.
+type Stream interface {
+	// Receive - Returns next received message.
+	// Returns io.EOF when peer finished the stream.
+	Receive() ([]byte, error)
+
+	// Send - Sends a message.
+	Send([]byte) error
+
+	// Shutdown - Finishes the stream.
+	// Called on Close when no Send is in progress.
+	Shutdown() error
+
+	// Release - Releases resources, for example zeroes the keys.
+	// Called on Close after Receive and Send returned.
+	Release()
+}
+
+// CloseWriter - Stream which can finish sending and keep receiving.
+type CloseWriter interface {
+	// CloseWrite - Finishes sending, peer receives io.EOF.
+	CloseWrite() error
+}
+
+// Conn - Connection reading and writing a stream on separate goroutines.
+//
+// Deadlines are not set on the underlying connection,
+// it is expected to be used only by the stream.
+type Conn struct {
+	net.Conn
+	stream Stream
+
+	messages chan []byte
+	readErr  error
+	reading  *sync.Mutex
+	pending  []byte
+	writes   chan *writeRequest
+	sending  *sync.Mutex
+	finished bool // write side closed, guarded by sending
+
+	readDeadline  *deadline
+	writeDeadline *deadline
+
+	once   *sync.Once
+	closed chan struct{}
+	reader chan struct{}
+	writer chan struct{}
+}
+
+type writeRequest struct {
+	body       []byte
+	closeWrite bool
+	state      int32 // one of request states, accessed atomically
+	err        chan error
+}
+
+// Write request states.
+const (
+	requestQueued int32 = iota
+	requestStarted
+	requestCancelled
+)
+
+// start - Marks request as being sent unless it was cancelled.
+func (req *writeRequest) start() bool {
+	return atomic.CompareAndSwapInt32(&req.state, requestQueued, requestStarted)
+}
+
+// cancel - Cancels request unless it's being sent.
+func (req *writeRequest) cancel() bool {
+	return atomic.CompareAndSwapInt32(&req.state, requestQueued, requestCancelled)
+}
+
+// NewConn - Creates a connection and starts reading the stream.
+func NewConn(conn net.Conn, stream Stream) *Conn {
+	c := &Conn{
+		Conn:          conn,
+		stream:        stream,
+		messages:      make(chan []byte),
+		reading:       new(sync.Mutex),
+		writes:        make(chan *writeRequest),
+		sending:       new(sync.Mutex),
+		readDeadline:  newDeadline(),
+		writeDeadline: newDeadline(),
+		once:          new(sync.Once),
+		closed:        make(chan struct{}),
+		reader:        make(chan struct{}),
+		writer:        make(chan struct{}),
+	}
+	go c.readLoop()
+	go c.writeLoop()
+	return c
+}
+
+// NetConn - Returns the underlying connection.
+func (conn *Conn) NetConn() net.Conn {
+	return conn.Conn
+}
+
+// Read - Reads data received from the stream.
+// Messages larger than b are returned in subsequent reads.
+func (conn *Conn) Read(b []byte) (n int, err error) {
+	conn.reading.Lock()
+	defer conn.reading.Unlock()
+
+	select {
+	case <-conn.closed:
+		return 0, net.ErrClosed
+	case <-conn.readDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+
+	for len(conn.pending) == 0 {
+		select {
+		case msg, ok := <-conn.messages:
+			if !ok {
+				return 0, conn.readErr
+			}
+			conn.pending = msg
+		case <-conn.readDeadline.wait():
+			return 0, os.ErrDeadlineExceeded
+		case <-conn.closed:
+			return 0, net.ErrClosed
+		}
+	}
+
+	n = copy(b, conn.pending)
+	conn.pending = conn.pending[n:]
+	return
+}
+
+// Write - Sends b as a message.
+// Write that timed out before the message started being sent
+// returns 0 and the message is dropped. Write that timed out while
+// the message is being sent returns len(b) with os.ErrDeadlineExceeded,
+// the message is sent unless the connection fails.
+func (conn *Conn) Write(b []byte) (n int, err error) {
+	select {
+	case <-conn.closed:
+		return 0, net.ErrClosed
+	case <-conn.writeDeadline.wait():
+		return 0, os.ErrDeadlineExceeded
+	default:
+	}
+
+	if len(b) == 0 {
+		return 0, nil
+	}
+
+	req := &writeRequest{
+		body: append([]byte(nil), b...),
+		err:  make(chan error, 1),
+	}
+	err = conn.send(req)
+	if err == nil || (errors.Is(err, os.ErrDeadlineExceeded) && atomic.LoadInt32(&req.state) == requestStarted) {
+		return len(b), err
+	}
+	return 0, err
+}
+
+// CloseWrite - Finishes sending after queued writes if the stream
+// implements CloseWriter, reading is not affected.
+// Returns ErrCloseWrite otherwise.
+func (conn *Conn) CloseWrite() error {
+	if _, ok := conn.stream.(CloseWriter); !ok {
+		return ErrCloseWrite
+	}
+	return conn.send(&writeRequest{closeWrite: true, err: make(chan error, 1)})
+}
+
+// send - Queues a request for the writing goroutine and waits for the result.
+// Request is cancelled if the deadline is exceeded before it started being sent.
+func (conn *Conn) send(req *writeRequest) error {
+	select {
+	case conn.writes <- req:
+	case <-conn.writeDeadline.wait():
+		return os.ErrDeadlineExceeded
+	case <-conn.closed:
+		return net.ErrClosed
+	}
+
+	select {
+	case err := <-req.err:
+		return err
+	case <-conn.writeDeadline.wait():
+		req.cancel()
+		return os.ErrDeadlineExceeded
+	case <-conn.closed:
+		return net.ErrClosed
+	}
+}
+
+// SetDeadline - Sets read and write deadlines.
+func (conn *Conn) SetDeadline(t time.Time) error {
+	conn.readDeadline.set(t)
+	conn.writeDeadline.set(t)
+	return nil
+}
+
+// SetReadDeadline - Sets read deadline.
+func (conn *Conn) SetReadDeadline(t time.Time) error {
+	conn.readDeadline.set(t)
+	return nil
+}
+
+// SetWriteDeadline - Sets write deadline.
+func (conn *Conn) SetWriteDeadline(t time.Time) error {
+	conn.writeDeadline.set(t)
+	return nil
+}
+
+// Close - Shuts down the stream if it's not busy sending,
+// closes the underlying connection and releases the stream.
+func (conn *Conn) Close() (err error) {
+	err = net.ErrClosed
+	conn.once.Do(func() {
+		close(conn.closed)
+		if conn.sending.TryLock() {
+			if !conn.finished {
+				conn.Conn.SetWriteDeadline(time.Now().Add(shutdownTimeout))
+				conn.stream.Shutdown()
+			}
+			conn.sending.Unlock()
+		}
+		err = conn.Conn.Close()
+		<-conn.reader
+		<-conn.writer
+		conn.stream.Release()
+	})
+	return
+}
+
+func (conn *Conn) readLoop() {
+	defer close(conn.reader)
+	defer close(conn.messages)
+	for {
+		msg, err := conn.stream.Receive()
+		if err != nil {
+			conn.readErr = err
+			return
+		}
+		select {
+		case conn.messages <- msg:
+		case <-conn.closed:
+			conn.readErr = net.ErrClosed
+			return
+		}
+	}
+}
+
+func (conn *Conn) writeLoop() {
+	defer close(conn.writer)
+	var err error
+	for {
+		select {
+		case req := <-conn.writes:
+			if !req.start() {
+				continue
+			}
+			conn.sending.Lock()
+			if err != nil {
+				req.err <- err
+			} else if req.closeWrite {
+				err = conn.stream.(CloseWriter).CloseWrite()
+				req.err <- err
+				if err == nil {
+					conn.finished = true
+					err = ErrWriteClosed
+				}
+			} else {
+				err = conn.stream.Send(req.body)
+				req.err <- err
+			}
+			conn.sending.Unlock()
+		case <-conn.closed:
+			return
+		}
+	}
+}
+
+// deadline - Deadline signalled by closing a channel.
+type deadline struct {
+	mutex  *sync.Mutex
+	timer  *time.Timer
+	cancel chan struct{}
+}
+
+func newDeadline() *deadline {
+	return &deadline{mutex: new(sync.Mutex), cancel: make(chan struct{})}
+}
+
+// set - Sets the deadline. Zero value clears it.
+func (d *deadline) set(t time.Time) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.timer != nil && !d.timer.Stop() {
+		<-d.cancel // wait for the timer to close the channel
+	}
+	d.timer = nil
+
+	closed := isClosed(d.cancel)
+	if t.IsZero() {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		return
+	}
+
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.cancel = make(chan struct{})
+		}
+		cancel := d.cancel
+		d.timer = time.AfterFunc(dur, func() { close(cancel) })
+		return
+	}
+
+	if !closed {
+		close(d.cancel)
+	}
+}
+
+// wait - Returns a channel closed when the deadline is exceeded.
+func (d *deadline) wait() chan struct{} {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	return d.cancel
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,91 @@
+package async
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testStream - Stream recording messages, Send blocks until released.
+type testStream struct {
+	conn    net.Conn
+	sent    chan string
+	release chan struct{}
+}
+
+func (s *testStream) Receive() ([]byte, error) {
+	b := make([]byte, 1024)
+	n, err := s.conn.Read(b)
+	return b[:n], err
+}
+
+func (s *testStream) Send(b []byte) error {
+	s.sent <- string(b)
+	<-s.release
+	return nil
+}
+
+func (s *testStream) Shutdown() error { return nil }
+
+func (s *testStream) Release() {}
+
+// result - Result of a Write.
+type result struct {
+	n   int
+	err error
+}
+
+func TestWriteDeadline(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	s := &testStream{conn: c1, sent: make(chan string, 10), release: make(chan struct{})}
+	conn := NewConn(c1, s)
+	defer conn.Close()
+	write := func(msg string) chan result {
+		c := make(chan result, 1)
+		go func() {
+			n, err := conn.Write([]byte(msg))
+			c <- result{n, err}
+		}()
+		return c
+	}
+
+	first := write("first")
+	if msg := <-s.sent; msg != "first" {
+		t.Fatalf("sending %q, want first", msg)
+	}
+	conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+	queued := write("queued")
+	// take the request like the writing goroutine would,
+	// it's busy sending the first message
+	req := <-conn.writes
+
+	// deadline expired while the message was being sent
+	if r := <-first; r.n != 5 || !errors.Is(r.err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write = %d, %v, want 5, %v", r.n, r.err, os.ErrDeadlineExceeded)
+	}
+	// deadline expired while the message was queued
+	if r := <-queued; r.n != 0 || !errors.Is(r.err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Write = %d, %v, want 0, %v", r.n, r.err, os.ErrDeadlineExceeded)
+	}
+	if state := atomic.LoadInt32(&req.state); state != requestCancelled {
+		t.Fatalf("queued request state = %d, want %d", state, requestCancelled)
+	}
+
+	// cancelled request is dropped by the writing goroutine
+	close(s.release)
+	conn.writes <- req
+	conn.SetWriteDeadline(time.Time{})
+	if r := <-write("third"); r.n != 5 || r.err != nil {
+		t.Fatalf("Write = %d, %v, want 5, nil", r.n, r.err)
+	}
+	if msg := <-s.sent; msg != "third" {
+		t.Fatalf("sent %q, want third", msg)
+	}
+	if len(req.err) != 0 {
+		t.Fatal("cancelled request was answered")
+	}
+}
@@ -0,0 +1,55 @@
+package frame
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrNonceExhausted - Frame counter overflowed, connection has to be reestablished.
+var ErrNonceExhausted = errors.New("frame: nonce exhausted")
+
+// AEAD - Cipher sealing frames with an AEAD and a counter nonce.
+// Every direction must use a different key. Replayed, reordered
+// or dropped frames fail to open.
+type AEAD struct {
+	aead  cipher.AEAD
+	nonce []byte
+	count uint64
+}
+
+// NewAEAD - Creates a frame cipher from an AEAD.
+func NewAEAD(aead cipher.AEAD) *AEAD {
+	return &AEAD{aead: aead, nonce: make([]byte, aead.NonceSize())}
+}
+
+// Seal - Encrypts frame body with next nonce.
+func (c *AEAD) Seal(plaintext []byte) ([]byte, error) {
+	if c.count == ^uint64(0) {
+		return nil, ErrNonceExhausted
+	}
+	binary.LittleEndian.PutUint64(c.nonce, c.count)
+	c.count++
+	return c.aead.Seal(nil, c.nonce, plaintext, nil), nil
+}
+
+// Open - Decrypts frame body with next nonce.
+func (c *AEAD) Open(ciphertext []byte) ([]byte, error) {
+	binary.LittleEndian.PutUint64(c.nonce, c.count)
+	plaintext, err := c.aead.Open(nil, c.nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.count++
+	return plaintext, nil
+}
+
+// Rewind - Reverts last Seal.
+func (c *AEAD) Rewind() {
+	c.count--
+}
+
+// Overhead - Returns AEAD overhead.
+func (c *AEAD) Overhead() int {
+	return c.aead.Overhead()
+}
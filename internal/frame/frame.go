@@ -0,0 +1,312 @@
+// Package frame implements length-prefixed framing of encrypted streams
+// shared by encryption layers.
+//
+// Every frame is a 2 byte big-endian length followed by the frame body.
+// Encrypted streams are finished with a sealed empty frame, so truncation
+// of the stream by an attacker is detected.
+package frame
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MaxSize - Maximum size of a frame body.
+const MaxSize = 65535
+
+// closeTimeout - Time limit for sending close frame on Close.
+const closeTimeout = time.Second
+
+// ErrTooLarge - Frame body exceeds MaxSize.
+var ErrTooLarge = errors.New("frame: frame too large")
+
+// ErrWriteClosed - Write side of the connection was closed with CloseWrite.
+var ErrWriteClosed = errors.New("frame: write side closed")
+
+// Write - Writes a single frame.
+func Write(w io.Writer, body []byte) error {
+	b, err := encode(body)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Exchange - Writes a frame and reads peer frame at the same time.
+func Exchange(conn io.ReadWriter, body []byte) ([]byte, error) {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Write(conn, body)
+	}()
+	peer, err := Read(conn)
+	if werr := <-errc; err == nil {
+		err = werr
+	}
+	return peer, err
+}
+
+func encode(body []byte) ([]byte, error) {
+	if len(body) > MaxSize {
+		return nil, ErrTooLarge
+	}
+	b := make([]byte, 2+len(body))
+	binary.BigEndian.PutUint16(b, uint16(len(body)))
+	copy(b[2:], body)
+	return b, nil
+}
+
+// Read - Reads a single frame.
+func Read(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return body, nil
+}
+
+// Cipher - Seals and opens consecutive frame bodies.
+type Cipher interface {
+	// Seal - Encrypts next frame body.
+	Seal(plaintext []byte) ([]byte, error)
+
+	// Open - Decrypts and authenticates next frame body.
+	Open(ciphertext []byte) ([]byte, error)
+
+	// Rewind - Reverts last Seal, its frame was never sent.
+	Rewind()
+
+	// Overhead - Returns number of bytes added by Seal.
+	Overhead() int
+}
+
+// Conn - Connection exchanging frames sealed with ciphers.
+//
+// Deadlines are set on the underlying connection.
+// Like with TLS, a timeout in the middle of a frame
+// leaves the connection unusable.
+//
+// Read returns io.EOF only after peer sent a close frame,
+// end of the underlying stream without it is io.ErrUnexpectedEOF.
+type Conn struct {
+	net.Conn
+
+	send Cipher
+	recv Cipher
+
+	reading *sync.Mutex
+	pending []byte
+	readErr error
+
+	// partially read frame kept over read timeouts
+	head  [2]byte
+	nhead int
+	body  []byte
+	nbody int
+
+	writing  *sync.Mutex
+	writeErr error
+	unsent   []byte // frame remainder kept over write timeouts
+}
+
+// NewConn - Creates a connection sealing frames with send cipher
+// and opening them with recv cipher.
+func NewConn(conn net.Conn, send, recv Cipher) *Conn {
+	return &Conn{
+		Conn:    conn,
+		send:    send,
+		recv:    recv,
+		reading: new(sync.Mutex),
+		writing: new(sync.Mutex),
+	}
+}
+
+// NetConn - Returns the underlying connection.
+func (conn *Conn) NetConn() net.Conn {
+	return conn.Conn
+}
+
+// Read - Reads decrypted data. Frames larger than b
+// are returned in subsequent reads.
+func (conn *Conn) Read(b []byte) (n int, err error) {
+	conn.reading.Lock()
+	defer conn.reading.Unlock()
+
+	for len(conn.pending) == 0 {
+		if conn.readErr != nil {
+			return 0, conn.readErr
+		}
+		body, err := conn.readFrame()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return 0, err
+			}
+			conn.readErr = err
+			return 0, err
+		}
+		conn.pending, err = conn.recv.Open(body)
+		if err != nil {
+			conn.readErr = err
+			return 0, err
+		}
+		if len(conn.pending) == 0 {
+			// close frame, data frames are never empty
+			conn.readErr = io.EOF
+			return 0, io.EOF
+		}
+	}
+
+	n = copy(b, conn.pending)
+	conn.pending = conn.pending[n:]
+	return
+}
+
+// readFrame - Reads next frame. Read progress is kept
+// when underlying connection read times out.
+func (conn *Conn) readFrame() ([]byte, error) {
+	for conn.nhead < len(conn.head) {
+		n, err := conn.Conn.Read(conn.head[conn.nhead:])
+		conn.nhead += n
+		if err != nil {
+			if err == io.EOF {
+				// stream has to be finished with a close frame
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	if conn.body == nil {
+		conn.body = make([]byte, binary.BigEndian.Uint16(conn.head[:]))
+		conn.nbody = 0
+	}
+	for conn.nbody < len(conn.body) {
+		n, err := conn.Conn.Read(conn.body[conn.nbody:])
+		conn.nbody += n
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	body := conn.body
+	conn.nhead, conn.body = 0, nil
+	return body, nil
+}
+
+// Write - Encrypts and writes data in frames.
+func (conn *Conn) Write(b []byte) (n int, err error) {
+	conn.writing.Lock()
+	defer conn.writing.Unlock()
+
+	if conn.writeErr != nil {
+		return 0, conn.writeErr
+	}
+	if len(conn.unsent) > 0 {
+		if err := conn.writeFrame(conn.unsent); err != nil {
+			return 0, err
+		}
+	}
+
+	max := MaxSize - conn.send.Overhead()
+	for n < len(b) {
+		chunk := b[n:]
+		if len(chunk) > max {
+			chunk = chunk[:max]
+		}
+		body, err := conn.send.Seal(chunk)
+		if err == nil {
+			body, err = encode(body)
+		}
+		if err != nil {
+			conn.writeErr = err
+			return n, err
+		}
+		err = conn.writeFrame(body)
+		if len(conn.unsent) == len(body) {
+			// nothing was written, frame can be sealed again
+			conn.unsent = nil
+			conn.send.Rewind()
+		} else {
+			n += len(chunk)
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+	return
+}
+
+// CloseWrite - Sends a close frame and closes write side
+// of the underlying connection if it supports it.
+func (conn *Conn) CloseWrite() error {
+	conn.writing.Lock()
+	defer conn.writing.Unlock()
+	if err := conn.writeClose(); err != nil {
+		return err
+	}
+	if cw, ok := conn.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Close - Sends a close frame if no Write is in progress
+// and closes the underlying connection.
+func (conn *Conn) Close() error {
+	if conn.writing.TryLock() {
+		conn.Conn.SetWriteDeadline(time.Now().Add(closeTimeout))
+		conn.writeClose()
+		conn.writing.Unlock()
+	}
+	return conn.Conn.Close()
+}
+
+// writeClose - Writes a close frame unless write side is already closed
+// or a frame was partially written.
+func (conn *Conn) writeClose() error {
+	if conn.writeErr != nil {
+		return conn.writeErr
+	}
+	if len(conn.unsent) > 0 {
+		if err := conn.writeFrame(conn.unsent); err != nil {
+			return err
+		}
+	}
+	body, err := conn.send.Seal(nil)
+	if err == nil {
+		body, err = encode(body)
+	}
+	if err == nil {
+		err = conn.writeFrame(body)
+	}
+	if err == nil {
+		conn.writeErr = ErrWriteClosed
+	}
+	return err
+}
+
+// writeFrame - Writes encoded frame. Unsent remainder is kept
+// when underlying connection write times out.
+func (conn *Conn) writeFrame(b []byte) error {
+	n, err := conn.Conn.Write(b)
+	conn.unsent = b[n:]
+	if err == nil {
+		return nil
+	}
+	if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+		conn.writeErr = err
+	}
+	return err
+}
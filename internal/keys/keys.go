@@ -0,0 +1,57 @@
+// Package keys implements encoding of keys in layer parameters.
+package keys
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Decode - Decodes base64 encoded 32 byte key.
+func Decode(s string) (*[32]byte, error) {
+	body, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %v", err)
+	}
+	if len(body) != 32 {
+		return nil, fmt.Errorf("invalid key size %d", len(body))
+	}
+	key := new([32]byte)
+	copy(key[:], body)
+	return key, nil
+}
+
+// DecodeAll - Decodes base64 encoded 32 byte keys.
+func DecodeAll(list []string) (keys []*[32]byte, err error) {
+	for _, s := range list {
+		key, err := Decode(s)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return
+}
+
+// Public - Returns X25519 public key of a private key.
+func Public(priv *[32]byte) (*[32]byte, error) {
+	body, err := curve25519.X25519(priv[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	pub := new([32]byte)
+	copy(pub[:], body)
+	return pub, nil
+}
+
+// DecodePair - Decodes base64 encoded X25519 private key
+// and returns it with its public key.
+func DecodePair(s string) (pub, priv *[32]byte, err error) {
+	priv, err = Decode(s)
+	if err != nil {
+		return
+	}
+	pub, err = Public(priv)
+	return
+}
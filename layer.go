@@ -1,30 +1,82 @@
 package onion
 
 import (
+	"errors"
 	"net"
 	"time"
 )
 
 // Layer - Onion layer.
+//
+// Roles of a layer are described by optional interfaces it implements:
+// Dialer, ChainDialer, Wrapper, ListenerSource and ListenerWrapper.
+// Layers have to implement at least one of them.
 type Layer interface {
 	// Name - Layer name.
 	Name() string
 
+	// Close - Closes the layer, removes the keys, closes tor instance etc.
+	Close() error
+}
+
+// Dialer - Layer which dials connections, for example net or tor.
+// It has to be the first layer of the dial path.
+type Dialer interface {
+	Layer
+
+	// Dial - Dials to address with a timeout.
+	Dial(addr string, timeout time.Duration) (net.Conn, error)
+}
+
+// ChainDialer - Dialer layer which can dial through a connection
+// established by previous dialer layers of the onion, for example
+// by running a proxy handshake over the connection to the proxy.
+type ChainDialer interface {
+	Dialer
+
+	// ProxyAddr - Returns address previous dialer layer has to connect to.
+	ProxyAddr() (string, error)
+
+	// DialConn - Dials to address through a connection to the proxy.
+	DialConn(conn net.Conn, addr string, timeout time.Duration) (net.Conn, error)
+}
+
+// Wrapper - Layer which wraps connections dialed by previous layers,
+// for example encryption layers.
+type Wrapper interface {
+	Layer
+
 	// Conn - Wraps connection with a layer.
-	// Some layers do nothing - for example TOR cant wrap existing connection.
-	// It's usable for encryption layers.
 	Conn(net.Conn) (net.Conn, error)
+}
+
+// ListenerSource - Layer which creates listeners, for example net.
+// It has to be the first layer of the listen path.
+type ListenerSource interface {
+	Layer
+
+	// Listen - Creates a listener.
+	Listen() (net.Listener, error)
+}
+
+// ListenerWrapper - Layer which wraps listeners of previous layers,
+// for example encryption layers or tor exposing a listener as onion service.
+type ListenerWrapper interface {
+	Layer
 
 	// Listener - Wraps listener with a layer.
 	Listener(net.Listener) (net.Listener, error)
+}
 
-	// Dial - Dials to address with a timeout.
-	Dial(addr string, timeout time.Duration) (net.Conn, error) // Bool is false when it should be ignored
-
-	// IsDialer - Returns false if the layer is just an encryption (and/or listening) layer.
-	// Returns true if layer can dial. For example net, tor etc.
-	IsDialer() bool
+// ErrCloseWrite - Connection doesn't support closing its write side.
+var ErrCloseWrite = errors.New("onion: connection does not support CloseWrite")
 
-	// Close - Closes the layer, removes the keys, closes tor instance etc.
-	Close() error
+// CloseWrite - Closes write side of the connection if it implements CloseWrite.
+// Layers which only pass data through implement CloseWrite with it,
+// layers with their own framing send their close message first.
+func CloseWrite(conn net.Conn) error {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return ErrCloseWrite
 }
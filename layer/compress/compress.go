@@ -0,0 +1,230 @@
+// Package compress implements stream compression layer.
+//
+// Both sides send a header frame with comma separated list of supported
+// algorithms in order of preference. First algorithm of the dialing side
+// supported by the listening side is used. Every write is flushed,
+// so interactive protocols don't stall. Zstd window is limited to 8 MiB,
+// streams of peers using larger windows are rejected.
+//
+// Compression layer has to be listed after encryption layers in an onion,
+// so data is compressed before it's encrypted.
+package compress
+
+import (
+	"compress/flate"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
+	"github.com/crackcomm/onion/internal/async"
+	"github.com/crackcomm/onion/internal/frame"
+)
+
+// Algorithm - Compression algorithm name.
+type Algorithm string
+
+const (
+	// Zstd - Zstandard compression.
+	Zstd Algorithm = "zstd"
+
+	// Snappy - Snappy framed compression.
+	Snappy Algorithm = "snappy"
+
+	// Flate - DEFLATE compression.
+	Flate Algorithm = "flate"
+)
+
+// zstdWindow - Maximum zstd window size, it bounds memory a peer
+// can make the decoder allocate per connection.
+const zstdWindow = 8 << 20
+
+// ErrNoAlgorithm - Peers have no compression algorithm in common.
+var ErrNoAlgorithm = errors.New("compress: no common algorithm")
+
+// Layer - Compression Layer.
+type Layer struct {
+	algorithms []Algorithm
+	level      int
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new compression layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{
+		algorithms: []Algorithm{Zstd, Snappy, Flate},
+		level:      flate.DefaultCompression,
+	}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// Name - Returns "compress".
+func (layer *Layer) Name() string { return "compress" }
+
+// Listener - Wraps listener with a compression layer.
+// Algorithms are negotiated concurrently with a deadline.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	return accept.NewListener(l, "compress", func(conn net.Conn) (net.Conn, error) {
+		return layer.negotiate(conn, false)
+	}), nil
+}
+
+// Conn - Negotiates algorithm and wraps the connection.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	return layer.negotiate(conn, true)
+}
+
+// negotiate - Exchanges headers and creates compressed connection.
+func (layer *Layer) negotiate(conn net.Conn, initiator bool) (net.Conn, error) {
+	names := make([]string, len(layer.algorithms))
+	for i, algorithm := range layer.algorithms {
+		names[i] = string(algorithm)
+	}
+	header, err := frame.Exchange(conn, []byte(strings.Join(names, ",")))
+	if err != nil {
+		return nil, err
+	}
+	peer := strings.Split(string(header), ",")
+
+	algorithm, ok := choose(names, peer, initiator)
+	if !ok {
+		return nil, ErrNoAlgorithm
+	}
+	return newConnection(conn, algorithm, layer.level)
+}
+
+// choose - Returns first algorithm of the dialing side supported by both.
+func choose(our, peer []string, initiator bool) (Algorithm, bool) {
+	dialer, other := our, peer
+	if !initiator {
+		dialer, other = peer, our
+	}
+	for _, name := range dialer {
+		for _, o := range other {
+			if name == o {
+				return Algorithm(name), true
+			}
+		}
+	}
+	return "", false
+}
+
+// Option - Compression layer option.
+type Option func(*Layer)
+
+// WithAlgorithms - Sets supported algorithms in order of preference
+// (default: zstd, snappy, flate).
+func WithAlgorithms(algorithms ...Algorithm) Option {
+	return func(layer *Layer) {
+		layer.algorithms = algorithms
+	}
+}
+
+// WithLevel - Sets flate compression level.
+func WithLevel(level int) Option {
+	return func(layer *Layer) {
+		layer.level = level
+	}
+}
+
+// writer - Compressing writer.
+type writer interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// newConnection - Creates compressed connection.
+func newConnection(conn net.Conn, algorithm Algorithm, level int) (net.Conn, error) {
+	s := &stream{conn: conn, buf: make([]byte, 32*1024), release: func() {}}
+	switch algorithm {
+	case Zstd:
+		w, err := zstd.NewWriter(conn, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(zstdWindow))
+		if err != nil {
+			return nil, err
+		}
+		r, err := zstd.NewReader(conn,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(zstdWindow),
+			zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, err
+		}
+		s.writer, s.reader, s.release = w, r, r.Close
+	case Snappy:
+		s.writer, s.reader = snappy.NewBufferedWriter(conn), snappy.NewReader(conn)
+	case Flate:
+		w, err := flate.NewWriter(conn, level)
+		if err != nil {
+			return nil, err
+		}
+		s.writer, s.reader = w, flate.NewReader(conn)
+	default:
+		return nil, fmt.Errorf("compress: unsupported algorithm %q", algorithm)
+	}
+	return async.NewConn(conn, s), nil
+}
+
+// stream - Compressed stream.
+type stream struct {
+	conn    net.Conn
+	reader  io.Reader
+	writer  writer
+	release func()
+	buf     []byte
+}
+
+// Receive - Returns decompressed data.
+func (s *stream) Receive() ([]byte, error) {
+	n, err := s.reader.Read(s.buf)
+	if n > 0 {
+		return append([]byte(nil), s.buf[:n]...), nil
+	}
+	return nil, err
+}
+
+// Send - Compresses and flushes data, so interactive protocols don't stall.
+func (s *stream) Send(b []byte) error {
+	if _, err := s.writer.Write(b); err != nil {
+		return err
+	}
+	return s.writer.Flush()
+}
+
+// Shutdown - Finishes compressed stream.
+func (s *stream) Shutdown() error {
+	return s.writer.Close()
+}
+
+// CloseWrite - Finishes compressed stream and closes write side
+// of the connection. Peer decompressor ends with the connection,
+// so it's not supported when the connection can't close its write side.
+func (s *stream) CloseWrite() error {
+	cw, ok := s.conn.(interface{ CloseWrite() error })
+	if !ok {
+		return onion.ErrCloseWrite
+	}
+	if err := s.writer.Close(); err != nil {
+		return err
+	}
+	return cw.CloseWrite()
+}
+
+// Release - Releases decompressor.
+func (s *stream) Release() {
+	s.release()
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
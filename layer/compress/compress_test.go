@@ -0,0 +1,123 @@
+package compress
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/layertest"
+)
+
+var algorithms = []Algorithm{Zstd, Snappy, Flate}
+
+func TestConn(t *testing.T) {
+	for _, algorithm := range algorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			layer := NewLayer(WithAlgorithms(algorithm))
+			layertest.TestConn(t, layer, layer)
+		})
+	}
+}
+
+func TestChoose(t *testing.T) {
+	for _, test := range []struct {
+		our, peer []string
+		initiator bool
+		want      Algorithm
+		ok        bool
+	}{
+		{our: []string{"flate", "zstd"}, peer: []string{"zstd", "snappy", "flate"}, initiator: true, want: Flate, ok: true},
+		{our: []string{"zstd", "snappy", "flate"}, peer: []string{"flate", "zstd"}, want: Flate, ok: true},
+		{our: []string{"snappy", "zstd"}, peer: []string{"zstd"}, initiator: true, want: Zstd, ok: true},
+		{our: []string{"zstd"}, peer: []string{"snappy"}, initiator: true},
+		{our: []string{"zstd"}, peer: []string{""}},
+	} {
+		got, ok := choose(test.our, test.peer, test.initiator)
+		if got != test.want || ok != test.ok {
+			t.Errorf("choose(%v, %v, %t) = %q, %t, want %q, %t", test.our, test.peer, test.initiator, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestNoAlgorithm(t *testing.T) {
+	dialer := NewLayer(WithAlgorithms(Zstd))
+	listener := NewLayer(WithAlgorithms(Snappy))
+	if _, _, _, err := layertest.MakePipe(dialer, listener)(); !errors.Is(err, ErrNoAlgorithm) {
+		t.Fatalf("dial error = %v, want %v", err, ErrNoAlgorithm)
+	}
+}
+
+func TestCloseWrite(t *testing.T) {
+	for _, algorithm := range algorithms {
+		t.Run(string(algorithm), func(t *testing.T) {
+			layer := NewLayer(WithAlgorithms(algorithm))
+			c1, c2, stop, err := layertest.MakePipe(layer, layer)()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+			if _, err := c1.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			if err := onion.CloseWrite(c1); err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(c2)
+			if err != nil || string(b) != "hello" {
+				t.Fatalf("read %q, %v, want hello", b, err)
+			}
+			if _, err := c2.Write([]byte("world")); err != nil {
+				t.Fatal(err)
+			}
+			c2.Close()
+			b, err = ioutil.ReadAll(c1)
+			if err != nil || string(b) != "world" {
+				t.Fatalf("read %q, %v, want world", b, err)
+			}
+		})
+	}
+}
+
+func TestZstdWindow(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		window int
+		err    error
+	}{
+		{name: "allowed", window: zstdWindow},
+		{name: "oversized", window: 64 << 20, err: zstd.ErrWindowSizeExceeded},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c1, c2 := net.Pipe()
+			defer c2.Close()
+			conn, err := newConnection(c1, Zstd, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			go func() {
+				w, err := zstd.NewWriter(c2, zstd.WithWindowSize(test.window))
+				if err != nil {
+					return
+				}
+				w.Write([]byte("hello"))
+				w.Flush()
+			}()
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			b := make([]byte, 5)
+			_, err = io.ReadFull(conn, b)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("read error = %v, want %v", err, test.err)
+			}
+			if err == nil && string(b) != "hello" {
+				t.Fatalf("read %q, want hello", b)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package compress
+
+import (
+	"fmt"
+
+	"github.com/crackcomm/onion"
+)
+
+func init() {
+	onion.Register("compress", FromParams, onion.LayerInfo{
+		Description: "Compresses streams with an algorithm negotiated by peers",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - Compression layer parameters.
+type params struct {
+	Algorithms []Algorithm `yaml:"algorithms" help:"supported algorithms in order of preference (zstd, snappy, flate)"`
+	Level      *int        `yaml:"level" help:"flate compression level"`
+}
+
+// FromParams - Creates a compression layer from parameters:
+// algorithms (in order of preference) and level.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if len(c.Algorithms) > 0 {
+		for _, algorithm := range c.Algorithms {
+			switch algorithm {
+			case Zstd, Snappy, Flate:
+			default:
+				return nil, fmt.Errorf("compress: unknown algorithm %q", algorithm)
+			}
+		}
+		opts = append(opts, WithAlgorithms(c.Algorithms...))
+	}
+	if c.Level != nil {
+		opts = append(opts, WithLevel(*c.Level))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
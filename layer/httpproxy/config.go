@@ -0,0 +1,52 @@
+package httpproxy
+
+import (
+	"crypto/tls"
+
+	"github.com/crackcomm/onion"
+)
+
+func init() {
+	onion.Register("httpproxy", FromParams, onion.LayerInfo{
+		Description: "Dials through an HTTP CONNECT proxy",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - HTTP proxy layer parameters.
+type params struct {
+	Proxy    string            `yaml:"proxy" help:"proxy address (default: 127.0.0.1:8080)"`
+	TLS      bool              `yaml:"tls" help:"connect to the proxy over TLS"`
+	Username string            `yaml:"username" help:"basic authorization username"`
+	Password string            `yaml:"password" help:"basic authorization password"`
+	Headers  map[string]string `yaml:"headers" help:"headers of CONNECT requests"`
+}
+
+// FromParams - Creates an HTTP proxy layer from parameters:
+// proxy, tls, username, password and headers.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.Proxy != "" {
+		opts = append(opts, WithProxy(c.Proxy))
+	}
+	if c.TLS {
+		opts = append(opts, WithTLS(new(tls.Config)))
+	}
+	if c.Username != "" {
+		opts = append(opts, WithBasicAuth(c.Username, c.Password))
+	}
+	for key, value := range c.Headers {
+		opts = append(opts, WithHeader(key, value))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
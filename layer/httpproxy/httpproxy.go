@@ -0,0 +1,167 @@
+// Package httpproxy implements HTTP CONNECT proxy dialer layer.
+package httpproxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/proxyutil"
+)
+
+// Layer - HTTP proxy Layer.
+type Layer struct {
+	proxy  string
+	tls    *tls.Config
+	user   *url.Userinfo
+	header http.Header
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new HTTP proxy layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{proxy: "127.0.0.1:8080", header: make(http.Header)}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// Name - Returns "httpproxy".
+func (layer *Layer) Name() string { return "httpproxy" }
+
+// Dial - Dials through an HTTP proxy.
+func (layer *Layer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", layer.proxy, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	glog.V(2).Infof("[httpproxy] proxy => %s => %s", layer.proxy, addr)
+	return layer.DialConn(conn, addr, timeout)
+}
+
+// ProxyAddr - Returns HTTP proxy address.
+func (layer *Layer) ProxyAddr() (string, error) {
+	return layer.proxy, nil
+}
+
+// DialConn - Dials through a connection to an HTTP proxy.
+func (layer *Layer) DialConn(conn net.Conn, addr string, timeout time.Duration) (net.Conn, error) {
+	if layer.tls != nil {
+		conn = tls.Client(conn, layer.tlsConfig())
+	}
+	c, err := layer.connect(conn, addr, timeout)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// tlsConfig - Returns TLS config with server name of the proxy.
+func (layer *Layer) tlsConfig() *tls.Config {
+	if layer.tls.ServerName != "" {
+		return layer.tls
+	}
+	config := layer.tls.Clone()
+	config.ServerName, _, _ = net.SplitHostPort(layer.proxy)
+	return config
+}
+
+// connect - Requests a tunnel to the address over the proxy connection.
+func (layer *Layer) connect(conn net.Conn, addr string, timeout time.Duration) (net.Conn, error) {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: layer.header.Clone(),
+	}
+	if layer.user != nil {
+		pass, _ := layer.user.Password()
+		req.SetBasicAuth(layer.user.Username(), pass)
+		req.Header.Set("Proxy-Authorization", req.Header.Get("Authorization"))
+		req.Header.Del("Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("httpproxy: %s", resp.Status)
+	}
+	return &connection{Conn: proxyutil.Conn{Conn: conn, Addr: addr}, reader: r}, nil
+}
+
+// Option - HTTP proxy layer option.
+type Option func(*Layer)
+
+// WithProxy - Sets proxy address (default: 127.0.0.1:8080).
+func WithProxy(proxy string) Option {
+	return func(layer *Layer) {
+		layer.proxy = proxy
+	}
+}
+
+// WithTLS - Connects to the proxy over TLS.
+// Server name defaults to the proxy host.
+func WithTLS(config *tls.Config) Option {
+	return func(layer *Layer) {
+		layer.tls = config
+	}
+}
+
+// WithBasicAuth - Sets proxy basic authorization credentials.
+func WithBasicAuth(username, password string) Option {
+	return func(layer *Layer) {
+		layer.user = url.UserPassword(username, password)
+	}
+}
+
+// WithHeader - Adds a header to the CONNECT request.
+func WithHeader(key, value string) Option {
+	return func(layer *Layer) {
+		layer.header.Add(key, value)
+	}
+}
+
+// connection - Connection tunneled through a proxy.
+type connection struct {
+	proxyutil.Conn
+	reader *bufio.Reader
+}
+
+// Read - Reads data buffered with the proxy response first.
+func (conn *connection) Read(b []byte) (int, error) {
+	if conn.reader != nil {
+		if conn.reader.Buffered() > 0 {
+			return conn.reader.Read(b)
+		}
+		conn.reader = nil
+	}
+	return conn.Conn.Read(b)
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
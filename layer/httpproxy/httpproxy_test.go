@@ -0,0 +1,127 @@
+package httpproxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// echo - Returns address of a server echoing data.
+func echo(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// proxy - Returns address of a CONNECT proxy requiring credentials if set.
+// Value of X-Banner header is sent in the same write as the response.
+func proxy(t *testing.T, username, password string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if username != "" {
+			r.Header.Set("Authorization", r.Header.Get("Proxy-Authorization"))
+			if u, p, ok := r.BasicAuth(); !ok || u != username || p != password {
+				w.WriteHeader(http.StatusProxyAuthRequired)
+				return
+			}
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte("HTTP/1.1 200 OK\r\n\r\n" + r.Header.Get("X-Banner")))
+		go io.Copy(target, buf)
+		io.Copy(conn, target)
+	}))
+	t.Cleanup(server.Close)
+	return server.Listener.Addr().String()
+}
+
+func TestDial(t *testing.T) {
+	target := echo(t)
+	for _, test := range []struct {
+		name   string
+		layer  *Layer
+		banner string
+	}{
+		{name: "plain", layer: NewLayer(WithProxy(proxy(t, "", "")))},
+		{name: "auth", layer: NewLayer(WithProxy(proxy(t, "user", "pass")), WithBasicAuth("user", "pass"))},
+		{name: "buffered", layer: NewLayer(WithProxy(proxy(t, "", "")), WithHeader("X-Banner", "banner")), banner: "banner"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conn, err := test.layer.Dial(target, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if addr := conn.RemoteAddr().String(); addr != target {
+				t.Fatalf("remote address = %s, want %s", addr, target)
+			}
+			if _, err := conn.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			want := test.banner + "hello"
+			b := make([]byte, len(want))
+			if _, err := io.ReadFull(conn, b); err != nil || string(b) != want {
+				t.Fatalf("read %q, %v, want %q", b, err, want)
+			}
+		})
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		layer  *Layer
+		target string
+		status string
+	}{
+		{name: "no auth", layer: NewLayer(WithProxy(proxy(t, "user", "pass"))), status: "407"},
+		{name: "wrong password", layer: NewLayer(WithProxy(proxy(t, "user", "pass")), WithBasicAuth("user", "wrong")), status: "407"},
+		{name: "unreachable", layer: NewLayer(WithProxy(proxy(t, "", ""))), target: "127.0.0.1:1", status: "502"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			target := test.target
+			if target == "" {
+				target = echo(t)
+			}
+			conn, err := test.layer.Dial(target, time.Second)
+			if err == nil {
+				conn.Close()
+				t.Fatal("dial through proxy succeeded")
+			}
+			if !strings.Contains(err.Error(), test.status) {
+				t.Fatalf("dial error = %v, want status %s", err, test.status)
+			}
+		})
+	}
+}
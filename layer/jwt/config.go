@@ -0,0 +1,66 @@
+package jwt
+
+import (
+	"time"
+
+	"github.com/crackcomm/onion"
+)
+
+func init() {
+	onion.Register("jwt", FromParams, onion.LayerInfo{
+		Description: "Authenticates dialing side with a JSON Web Token",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - JWT layer parameters.
+type params struct {
+	Token    string        `yaml:"token" help:"token sent by the dialing side"`
+	Secret   string        `yaml:"secret" help:"secret verifying HMAC signed tokens"`
+	Issuer   string        `yaml:"issuer" help:"required token issuer"`
+	Audience string        `yaml:"audience" help:"required token audience"`
+	Methods  []string      `yaml:"methods" help:"allowed signing methods"`
+	Leeway   time.Duration `yaml:"leeway" help:"leeway of expiry validation"`
+}
+
+// FromParams - Creates a JWT layer from parameters:
+// token sent by the dialing side, secret verifying HMAC signed tokens
+// on the listening side, issuer, audience, methods and leeway.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.Token != "" {
+		opts = append(opts, WithToken(c.Token))
+	}
+	if c.Secret != "" {
+		secret := []byte(c.Secret)
+		opts = append(opts, WithKeyLookup(func(string) (interface{}, error) {
+			return secret, nil
+		}))
+		if len(c.Methods) == 0 {
+			c.Methods = []string{"HS256", "HS384", "HS512"}
+		}
+	}
+	if len(c.Methods) > 0 {
+		opts = append(opts, WithMethods(c.Methods...))
+	}
+	if c.Issuer != "" {
+		opts = append(opts, WithIssuer(c.Issuer))
+	}
+	if c.Audience != "" {
+		opts = append(opts, WithAudience(c.Audience))
+	}
+	if c.Leeway != 0 {
+		opts = append(opts, WithLeeway(c.Leeway))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
@@ -0,0 +1,217 @@
+// Package jwt implements JWT authentication layer.
+//
+// Dialing side sends a signed token as the first frame.
+// Listening side verifies it with a key lookup function
+// and responds with an empty frame or an error frame.
+// Verified claims are available on accepted connections.
+package jwt
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
+	"github.com/crackcomm/onion/internal/frame"
+)
+
+// ErrRejected - Token was rejected by the listening side.
+var ErrRejected = errors.New("jwt: token rejected")
+
+// KeyLookupFunc - Returns key verifying tokens with a key id.
+// Key id is empty if token has no "kid" header.
+type KeyLookupFunc func(kid string) (interface{}, error)
+
+// Layer - JWT Layer.
+type Layer struct {
+	token    func() (string, error)
+	lookup   KeyLookupFunc
+	issuer   string
+	audience string
+	methods  []string
+	leeway   time.Duration
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new JWT layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// Name - Returns "jwt".
+func (layer *Layer) Name() string { return "jwt" }
+
+// Listener - Wraps listener with a JWT layer.
+// Tokens of accepted connections are verified concurrently with a deadline.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	if layer.lookup == nil {
+		return nil, errors.New("jwt: key lookup function is not set")
+	}
+	return accept.NewListener(l, "jwt", layer.accept), nil
+}
+
+// Conn - Sends a token and waits for the listening side to accept it.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	if layer.token == nil {
+		return nil, errors.New("jwt: token is not set")
+	}
+	token, err := layer.token()
+	if err != nil {
+		return nil, err
+	}
+	if err := frame.Write(conn, []byte(token)); err != nil {
+		return nil, err
+	}
+	status, err := frame.Read(conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(status) != 0 {
+		return nil, ErrRejected
+	}
+	return &connection{Conn: conn}, nil
+}
+
+// verify - Parses and verifies token.
+func (layer *Layer) verify(token string) (gojwt.MapClaims, error) {
+	opts := []gojwt.ParserOption{
+		gojwt.WithExpirationRequired(),
+		gojwt.WithLeeway(layer.leeway),
+	}
+	if layer.issuer != "" {
+		opts = append(opts, gojwt.WithIssuer(layer.issuer))
+	}
+	if layer.audience != "" {
+		opts = append(opts, gojwt.WithAudience(layer.audience))
+	}
+	if len(layer.methods) != 0 {
+		opts = append(opts, gojwt.WithValidMethods(layer.methods))
+	}
+	claims := gojwt.MapClaims{}
+	_, err := gojwt.ParseWithClaims(token, claims, func(t *gojwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return layer.lookup(kid)
+	}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// Option - JWT layer option.
+type Option func(*Layer)
+
+// WithToken - Sets token sent by the dialing side.
+func WithToken(token string) Option {
+	return func(layer *Layer) {
+		layer.token = func() (string, error) { return token, nil }
+	}
+}
+
+// WithTokenFunc - Sets function returning token for every connection.
+func WithTokenFunc(fn func() (string, error)) Option {
+	return func(layer *Layer) {
+		layer.token = fn
+	}
+}
+
+// WithKeyLookup - Sets key lookup function used by the listening side.
+func WithKeyLookup(lookup KeyLookupFunc) Option {
+	return func(layer *Layer) {
+		layer.lookup = lookup
+	}
+}
+
+// WithIssuer - Sets required token issuer.
+func WithIssuer(issuer string) Option {
+	return func(layer *Layer) {
+		layer.issuer = issuer
+	}
+}
+
+// WithAudience - Sets required token audience.
+func WithAudience(audience string) Option {
+	return func(layer *Layer) {
+		layer.audience = audience
+	}
+}
+
+// WithMethods - Sets allowed signing methods (e.g. "EdDSA", "ES256").
+func WithMethods(methods ...string) Option {
+	return func(layer *Layer) {
+		layer.methods = methods
+	}
+}
+
+// WithLeeway - Sets leeway for expiry and not before validation.
+func WithLeeway(leeway time.Duration) Option {
+	return func(layer *Layer) {
+		layer.leeway = leeway
+	}
+}
+
+// accept - Verifies token of accepted connection.
+// Peers with invalid tokens are told they are unauthorized.
+func (layer *Layer) accept(conn net.Conn) (net.Conn, error) {
+	token, err := frame.Read(conn)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := layer.verify(string(token))
+	if err != nil {
+		frame.Write(conn, []byte("unauthorized"))
+		return nil, err
+	}
+	if err := frame.Write(conn, nil); err != nil {
+		return nil, err
+	}
+	return &connection{Conn: conn, claims: claims}, nil
+}
+
+// connection - Connection authenticated with a token.
+type connection struct {
+	net.Conn
+	claims gojwt.MapClaims
+}
+
+// NetConn - Returns the underlying connection.
+func (conn *connection) NetConn() net.Conn {
+	return conn.Conn
+}
+
+// CloseWrite - Closes write side of the underlying connection.
+func (conn *connection) CloseWrite() error {
+	return onion.CloseWrite(conn.Conn)
+}
+
+// Claims - Returns verified token claims.
+// Nil on the dialing side.
+func (conn *connection) Claims() gojwt.MapClaims {
+	return conn.claims
+}
+
+// Claims - Returns claims verified by the outermost JWT layer
+// in the onion or nil if there is none.
+func Claims(conn net.Conn) (claims gojwt.MapClaims) {
+	onion.Walk(conn, func(c net.Conn) bool {
+		if jc, ok := c.(*connection); ok {
+			claims = jc.Claims()
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
@@ -0,0 +1,72 @@
+package jwt
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+
+	"github.com/crackcomm/onion/layertest"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func sign(t *testing.T, key []byte, claims gojwt.MapClaims) string {
+	token, err := gojwt.NewWithClaims(gojwt.SigningMethodHS256, claims).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func claims(issuer string, expires time.Time) gojwt.MapClaims {
+	return gojwt.MapClaims{"sub": "client", "iss": issuer, "exp": expires.Unix()}
+}
+
+func listener() *Layer {
+	return NewLayer(
+		WithKeyLookup(func(string) (interface{}, error) { return secret, nil }),
+		WithIssuer("onion"),
+		WithMethods("HS256"),
+	)
+}
+
+func TestConn(t *testing.T) {
+	token := sign(t, secret, claims("onion", time.Now().Add(time.Hour)))
+	layertest.TestConn(t, NewLayer(WithToken(token)), listener())
+}
+
+func TestClaims(t *testing.T) {
+	token := sign(t, secret, claims("onion", time.Now().Add(time.Hour)))
+	c1, c2, stop, err := layertest.MakePipe(NewLayer(WithToken(token)), listener())()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if claims := Claims(c1); claims != nil {
+		t.Fatalf("dialing side claims = %v, want nil", claims)
+	}
+	if sub := Claims(c2)["sub"]; sub != "client" {
+		t.Fatalf("sub = %v, want client", sub)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		token string
+	}{
+		{name: "expired", token: sign(t, secret, claims("onion", time.Now().Add(-time.Hour)))},
+		{name: "issuer", token: sign(t, secret, claims("other", time.Now().Add(time.Hour)))},
+		{name: "key", token: sign(t, []byte("other"), claims("onion", time.Now().Add(time.Hour)))},
+		{name: "malformed", token: "token"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, _, err := layertest.MakePipe(NewLayer(WithToken(test.token)), listener())()
+			if !errors.Is(err, ErrRejected) {
+				t.Fatalf("dial error = %v, want %v", err, ErrRejected)
+			}
+		})
+	}
+}
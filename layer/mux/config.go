@@ -0,0 +1,23 @@
+package mux
+
+import "github.com/crackcomm/onion"
+
+func init() {
+	onion.Register("mux", FromParams, onion.LayerInfo{
+		Description: "Multiplexes streams over a single connection",
+		Layer:       (*Layer)(nil),
+	})
+}
+
+// FromParams - Creates a multiplexing layer. It has no parameters.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	if err := p.Decode(&struct{}{}); err != nil {
+		return nil, err
+	}
+	layer := NewLayer()
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
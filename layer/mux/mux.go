@@ -0,0 +1,419 @@
+// Package mux implements stream multiplexing over onion connections.
+//
+// Layer multiplexes streams over every wrapped connection and its listener
+// accepts streams from all sessions. Onion returned by New reuses one session
+// per address, so repeated connections to the same peer don't pay
+// for a new circuit and handshakes.
+package mux
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/yamux"
+
+	"github.com/crackcomm/onion"
+)
+
+// Option - Multiplexing option.
+type Option func(*options)
+
+// options - Multiplexing options.
+type options struct {
+	config *yamux.Config
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{config: yamux.DefaultConfig()}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithConfig - Sets yamux session config.
+func WithConfig(config *yamux.Config) Option {
+	return func(o *options) {
+		o.config = config
+	}
+}
+
+// Layer - Multiplexing Layer.
+type Layer struct {
+	o *options
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new multiplexing layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	return &Layer{o: newOptions(opts)}
+}
+
+// Name - Returns "mux".
+func (layer *Layer) Name() string { return "mux" }
+
+// Listener - Wraps listener with a listener accepting streams from all sessions.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	return newListener(l, layer.o.config), nil
+}
+
+// Conn - Starts a session over the connection and opens a stream.
+// Session is closed with the stream. Use Session to open more streams.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	session, err := yamux.Client(conn, layer.o.config)
+	if err != nil {
+		return nil, err
+	}
+	s, err := session.OpenStream()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	return newStream(s, conn, session, true), nil
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
+
+// Session - Returns session of a stream or nil.
+func Session(conn net.Conn) *yamux.Session {
+	if s, ok := conn.(*stream); ok {
+		return s.session
+	}
+	return nil
+}
+
+// New - Returns an onion which multiplexes streams over one connection per address.
+// Listening side has to use the listener of the returned onion.
+func New(o onion.Onion, opts ...Option) *Onion {
+	return &Onion{
+		Onion:    o,
+		o:        newOptions(opts),
+		mutex:    new(sync.Mutex),
+		sessions: make(map[string]*session),
+	}
+}
+
+// Onion - Onion multiplexing streams over sessions.
+type Onion struct {
+	onion.Onion
+	o *options
+
+	mutex    *sync.Mutex
+	sessions map[string]*session
+}
+
+// session - Session to an address.
+type session struct {
+	mutex   *sync.Mutex
+	conn    net.Conn
+	session *yamux.Session
+}
+
+// Dial - Opens a stream to a target.
+func (on *Onion) Dial(network, addr string) (net.Conn, error) {
+	return on.Connect(addr, time.Second*30)
+}
+
+// Connect - Opens a stream to a target reusing established session.
+// Connects through the onion if there is no session.
+func (on *Onion) Connect(addr string, timeout time.Duration) (net.Conn, error) {
+	s := on.session(addr)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.session != nil && !s.session.IsClosed() {
+		if st, err := s.session.OpenStream(); err == nil {
+			return newStream(st, s.conn, s.session, false), nil
+		}
+		s.session.Close()
+	}
+
+	conn, err := on.Onion.Connect(addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := yamux.Client(conn, on.o.config)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	st, err := sess.OpenStream()
+	if err != nil {
+		sess.Close()
+		return nil, err
+	}
+	s.conn, s.session = conn, sess
+	return newStream(st, conn, sess, false), nil
+}
+
+func (on *Onion) session(addr string) *session {
+	on.mutex.Lock()
+	defer on.mutex.Unlock()
+	s, ok := on.sessions[addr]
+	if !ok {
+		s = &session{mutex: new(sync.Mutex)}
+		on.sessions[addr] = s
+	}
+	return s
+}
+
+// Listener - Wraps a listener with an onion and accepts streams from all sessions.
+func (on *Onion) Listener(in net.Listener) (net.Listener, error) {
+	l, err := on.Onion.Listener(in)
+	if err != nil {
+		return nil, err
+	}
+	return newListener(l, on.o.config), nil
+}
+
+// Layers - Returns layers of the multiplexed onion, so onion.SpecOf
+// renders them. Multiplexing by the onion is not a layer and is not included.
+func (on *Onion) Layers() []onion.Layer {
+	return onion.Layers(on.Onion)
+}
+
+// Describe - Returns paths of the onion with multiplexing as the last step.
+func (on *Onion) Describe() *onion.Description {
+	desc := on.Onion.Describe()
+	step := onion.Step{Layer: "mux", Index: -1}
+	if len(desc.Dial) > 0 {
+		step.Role = onion.RoleWrap
+		desc.Dial = append(desc.Dial, step)
+	}
+	if len(desc.Listen) > 0 {
+		step.Role = onion.RoleWrapListener
+		desc.Listen = append(desc.Listen, step)
+	}
+	return desc
+}
+
+// Close - Closes all sessions and the onion.
+func (on *Onion) Close() error {
+	on.mutex.Lock()
+	for addr, s := range on.sessions {
+		s.mutex.Lock()
+		if s.session != nil {
+			s.session.Close()
+		}
+		s.mutex.Unlock()
+		delete(on.sessions, addr)
+	}
+	on.mutex.Unlock()
+	return on.Onion.Close()
+}
+
+// idleInterval - Interval of checking if owned session has no streams.
+const idleInterval = 50 * time.Millisecond
+
+// stream - Multiplexed stream.
+type stream struct {
+	*yamux.Stream
+	conn    net.Conn
+	session *yamux.Session
+	owner   bool // true if session is closed with the stream
+
+	mutex         *sync.Mutex
+	writeDeadline time.Time
+	closed        bool
+}
+
+func newStream(s *yamux.Stream, conn net.Conn, session *yamux.Session, owner bool) *stream {
+	return &stream{
+		Stream:  s,
+		conn:    conn,
+		session: session,
+		owner:   owner,
+		mutex:   new(sync.Mutex),
+	}
+}
+
+// NetConn - Returns connection carrying the session.
+func (s *stream) NetConn() net.Conn {
+	return s.conn
+}
+
+// Read - Reads from the stream.
+func (s *stream) Read(b []byte) (int, error) {
+	n, err := s.Stream.Read(b)
+	if err != nil && s.isClosed() {
+		return n, net.ErrClosed
+	}
+	return n, err
+}
+
+// Write - Writes to the stream. Fails if write deadline already passed.
+func (s *stream) Write(b []byte) (int, error) {
+	s.mutex.Lock()
+	deadline := s.writeDeadline
+	s.mutex.Unlock()
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		return 0, os.ErrDeadlineExceeded
+	}
+	return s.Stream.Write(b)
+}
+
+// SetDeadline - Sets read and write deadlines.
+func (s *stream) SetDeadline(t time.Time) error {
+	s.SetWriteDeadline(t)
+	return s.SetReadDeadline(t)
+}
+
+// SetReadDeadline - Sets read deadline.
+func (s *stream) SetReadDeadline(t time.Time) error {
+	if s.isClosed() {
+		return net.ErrClosed
+	}
+	return s.Stream.SetReadDeadline(t)
+}
+
+// SetWriteDeadline - Sets write deadline.
+func (s *stream) SetWriteDeadline(t time.Time) error {
+	s.mutex.Lock()
+	s.writeDeadline = t
+	s.mutex.Unlock()
+	return s.Stream.SetWriteDeadline(t)
+}
+
+// CloseWrite - Closes write side of the stream.
+func (s *stream) CloseWrite() error {
+	return s.Stream.Close()
+}
+
+// Close - Closes the stream and interrupts pending reads.
+// Owned session is closed when all its streams are closed by both sides.
+func (s *stream) Close() error {
+	s.mutex.Lock()
+	if s.closed {
+		s.mutex.Unlock()
+		return net.ErrClosed
+	}
+	s.closed = true
+	s.mutex.Unlock()
+
+	err := s.Stream.Close()
+	s.Stream.SetReadDeadline(time.Unix(1, 0))
+	if s.owner {
+		go closeIdle(s.session)
+	}
+	return err
+}
+
+func (s *stream) isClosed() bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+// closeIdle - Closes session when it has no streams.
+// Closing it earlier could reset data not yet read by the peer.
+func closeIdle(session *yamux.Session) {
+	ticker := time.NewTicker(idleInterval)
+	defer ticker.Stop()
+	for session.NumStreams() > 0 {
+		select {
+		case <-ticker.C:
+		case <-session.CloseChan():
+			return
+		}
+	}
+	session.Close()
+}
+
+// listener - Listener accepting streams from all sessions.
+type listener struct {
+	net.Listener
+	config *yamux.Config
+
+	streams chan net.Conn
+	errs    chan error
+	once    *sync.Once
+	closed  chan struct{}
+}
+
+func newListener(l net.Listener, config *yamux.Config) *listener {
+	ln := &listener{
+		Listener: l,
+		config:   config,
+		streams:  make(chan net.Conn),
+		errs:     make(chan error),
+		once:     new(sync.Once),
+		closed:   make(chan struct{}),
+	}
+	go ln.acceptLoop()
+	return ln
+}
+
+// Accept - Accepts a stream from any session.
+// Errors of the underlying listener are returned too.
+func (l *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.streams:
+		return conn, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close - Closes the underlying listener, which stops the accept loop,
+// new connections are not accepted. Established sessions are not closed
+// immediately, streams already returned by Accept keep working.
+// Goroutine serving a session closes it when the peer opens a new stream,
+// which is closed without being accepted, or exits when the session fails.
+func (l *listener) Close() (err error) {
+	err = net.ErrClosed
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.Listener.Close()
+	})
+	return
+}
+
+func (l *listener) acceptLoop() {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.closed:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				l.Close()
+				return
+			}
+			continue
+		}
+		go l.serve(conn)
+	}
+}
+
+func (l *listener) serve(conn net.Conn) {
+	session, err := yamux.Server(conn, l.config)
+	if err != nil {
+		conn.Close()
+		return
+	}
+	for {
+		st, err := session.AcceptStream()
+		if err != nil {
+			session.Close()
+			return
+		}
+		select {
+		case l.streams <- newStream(st, conn, session, false):
+		case <-l.closed:
+			st.Close()
+			session.Close()
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package mux
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/onion"
+	netlayer "github.com/crackcomm/onion/layer/net"
+	"github.com/crackcomm/onion/layertest"
+)
+
+func TestConn(t *testing.T) {
+	layer := NewLayer()
+	layertest.TestConn(t, layer, layer)
+}
+
+func TestSessions(t *testing.T) {
+	server, err := onion.New(netlayer.NewLayer())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := New(server).Listener(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	base, err := onion.New(netlayer.NewLayer(netlayer.WithDial()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := New(base)
+	defer client.Close()
+
+	addr := l.Addr().String()
+	c1, err := client.Connect(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c1.Close()
+	c2, err := client.Connect(addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c2.Close()
+	if Session(c1) == nil || Session(c1) != Session(c2) {
+		t.Fatal("streams to the same address don't share a session")
+	}
+
+	for _, conn := range []io.ReadWriter{c1, c2} {
+		if _, err := conn.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 5)
+		if _, err := io.ReadFull(conn, b); err != nil || string(b) != "hello" {
+			t.Fatalf("read %q, %v, want hello", b, err)
+		}
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	base, err := onion.New(netlayer.NewLayer(netlayer.WithDial()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "dial: net dial => mux wrap\nlisten: net listen => mux wrap listener"
+	if desc := New(base).Describe().String(); desc != want {
+		t.Fatalf("description:\n%s\nwant:\n%s", desc, want)
+	}
+}
+
+func TestSpecOf(t *testing.T) {
+	base, err := onion.FromSpec("net(dial=true,port=0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer base.Close()
+	if spec, want := onion.SpecOf(New(base)), onion.SpecOf(base); spec != want || spec == "" {
+		t.Fatalf("SpecOf = %q, want %q", spec, want)
+	}
+}
@@ -0,0 +1,48 @@
+package nacl
+
+import (
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/keys"
+)
+
+func init() {
+	onion.Register("nacl", FromParams, onion.LayerInfo{
+		Description: "Encrypts streams with NaCl box keys",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - NaCl layer parameters.
+type params struct {
+	PrivateKey string        `yaml:"private_key" help:"base64 long-term private key"`
+	Peers      onion.Strings `yaml:"peers" help:"base64 trusted peer public keys"`
+}
+
+// FromParams - Creates a NaCl layer from parameters:
+// private_key (base64 long-term key) and peers (base64 peer keys).
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.PrivateKey != "" {
+		pub, priv, err := keys.DecodePair(c.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKeys(pub, priv))
+	}
+	peers, err := keys.DecodeAll(c.Peers)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, WithPeerKeys(peers...))
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
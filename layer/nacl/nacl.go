@@ -0,0 +1,253 @@
+// Package nacl implements NaCl box encryption layer.
+//
+// Both sides send a hello frame with long-term and ephemeral public keys,
+// then an auth frame with both ephemeral keys boxed with long-term keys:
+//
+//	hello: long-term public key (32) | ephemeral public key (32)
+//	auth:  nonce (24) | box(our ephemeral public key | peer ephemeral public key)
+//
+// Session keys are derived from X25519 shared secret of ephemeral keys,
+// one for each direction. Data is sent in length-prefixed secretbox frames
+// with counter nonces.
+package nacl
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
+	"github.com/crackcomm/onion/internal/frame"
+)
+
+const (
+	helloSize = 32 + 32
+	authSize  = 24 + 64 + box.Overhead
+)
+
+var (
+	// ErrUnauthorized - Peer long-term key is not trusted.
+	ErrUnauthorized = errors.New("nacl: peer key not allowed")
+
+	// ErrHandshake - Peer hello is malformed or not authentic.
+	ErrHandshake = errors.New("nacl: handshake error")
+
+	// ErrDecrypt - Frame could not be decrypted.
+	ErrDecrypt = errors.New("nacl: decryption error")
+)
+
+// Layer - NaCl box Layer.
+type Layer struct {
+	pub   *[32]byte
+	priv  *[32]byte
+	peers []*[32]byte
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new NaCl layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// GenerateKey - Generates a new long-term box key pair.
+// Uses crypto/rand if rand is nil.
+func GenerateKey(random io.Reader) (pub, priv *[32]byte, err error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	return box.GenerateKey(random)
+}
+
+// Name - Returns "nacl".
+func (layer *Layer) Name() string { return "nacl" }
+
+// Listener - Wraps listener with a NaCl layer.
+// Handshakes of accepted connections run concurrently with a deadline.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	return accept.NewListener(l, "nacl", func(conn net.Conn) (net.Conn, error) {
+		return layer.handshake(conn, false)
+	}), nil
+}
+
+// Conn - Performs a key exchange and wraps the connection.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	return layer.handshake(conn, true)
+}
+
+// handshake - Exchanges hello frames and derives session keys.
+func (layer *Layer) handshake(conn net.Conn, initiator bool) (net.Conn, error) {
+	if layer.pub == nil || layer.priv == nil {
+		return nil, errors.New("nacl: key pair is not set")
+	}
+
+	ephPub, ephPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := frame.Exchange(conn, append(layer.pub[:], ephPub[:]...))
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) != helloSize {
+		return nil, ErrHandshake
+	}
+	peer, peerEph := new([32]byte), new([32]byte)
+	copy(peer[:], msg[:32])
+	copy(peerEph[:], msg[32:])
+	if err := layer.verify(peer); err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+	auth := box.Seal(nonce[:], append(ephPub[:], peerEph[:]...), &nonce, peer, layer.priv)
+	msg, err = frame.Exchange(conn, auth)
+	if err != nil {
+		return nil, err
+	}
+	if len(msg) != authSize {
+		return nil, ErrHandshake
+	}
+	copy(nonce[:], msg[:24])
+	boxed, ok := box.Open(nil, msg[24:], &nonce, peer, layer.priv)
+	if !ok || !bytes.Equal(boxed, append(peerEph[:], ephPub[:]...)) {
+		return nil, ErrHandshake
+	}
+
+	var shared [32]byte
+	box.Precompute(&shared, peerEph, ephPriv)
+
+	// keys[:32] is used by initiator and keys[32:] by responder
+	h := sha512.New()
+	h.Write(shared[:])
+	if initiator {
+		h.Write(ephPub[:])
+		h.Write(peerEph[:])
+	} else {
+		h.Write(peerEph[:])
+		h.Write(ephPub[:])
+	}
+	keys := h.Sum(nil)
+	send, recv := &cipher{}, &cipher{}
+	if initiator {
+		copy(send.key[:], keys[:32])
+		copy(recv.key[:], keys[32:])
+	} else {
+		copy(send.key[:], keys[32:])
+		copy(recv.key[:], keys[:32])
+	}
+	for i := range shared {
+		shared[i] = 0
+	}
+	for i := range ephPriv {
+		ephPriv[i] = 0
+	}
+
+	return &connection{
+		Conn: frame.NewConn(conn, send, recv),
+		peer: peer,
+	}, nil
+}
+
+// verify - Verifies peer long-term key if peer keys are set.
+func (layer *Layer) verify(peer *[32]byte) error {
+	if len(layer.peers) == 0 {
+		return nil
+	}
+	for _, key := range layer.peers {
+		if subtle.ConstantTimeCompare(key[:], peer[:]) == 1 {
+			return nil
+		}
+	}
+	return ErrUnauthorized
+}
+
+// Option - NaCl layer option.
+type Option func(*Layer)
+
+// WithKeys - Sets our long-term key pair.
+func WithKeys(pub, priv *[32]byte) Option {
+	return func(layer *Layer) {
+		layer.pub = pub
+		layer.priv = priv
+	}
+}
+
+// WithPeerKeys - Adds trusted peer long-term keys.
+// If none are set any peer is accepted.
+func WithPeerKeys(keys ...*[32]byte) Option {
+	return func(layer *Layer) {
+		layer.peers = append(layer.peers, keys...)
+	}
+}
+
+// connection - Connection encrypted with session keys.
+type connection struct {
+	*frame.Conn
+	peer *[32]byte
+}
+
+// PeerKey - Returns peer long-term public key.
+func (conn *connection) PeerKey() *[32]byte {
+	return conn.peer
+}
+
+// cipher - Secretbox with a counter nonce.
+type cipher struct {
+	key   [32]byte
+	count uint64
+}
+
+func (c *cipher) nonce() (nonce [24]byte) {
+	binary.LittleEndian.PutUint64(nonce[:], c.count)
+	return
+}
+
+func (c *cipher) Seal(plaintext []byte) ([]byte, error) {
+	if c.count == ^uint64(0) {
+		return nil, errors.New("nacl: nonce exhausted")
+	}
+	nonce := c.nonce()
+	c.count++
+	return secretbox.Seal(nil, plaintext, &nonce, &c.key), nil
+}
+
+func (c *cipher) Open(ciphertext []byte) ([]byte, error) {
+	nonce := c.nonce()
+	plaintext, ok := secretbox.Open(nil, ciphertext, &nonce, &c.key)
+	if !ok {
+		return nil, ErrDecrypt
+	}
+	c.count++
+	return plaintext, nil
+}
+
+func (c *cipher) Rewind() {
+	c.count--
+}
+
+func (c *cipher) Overhead() int {
+	return secretbox.Overhead
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
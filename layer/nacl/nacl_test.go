@@ -0,0 +1,50 @@
+package nacl
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crackcomm/onion/layertest"
+)
+
+func generateKey(t *testing.T) (pub, priv *[32]byte) {
+	pub, priv, err := GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestConn(t *testing.T) {
+	layertest.TestConn(t, NewLayer(WithKeys(generateKey(t))), NewLayer(WithKeys(generateKey(t))))
+}
+
+func TestPeerKey(t *testing.T) {
+	pub, priv := generateKey(t)
+	dialer := NewLayer(WithKeys(generateKey(t)), WithPeerKeys(pub))
+	c1, _, stop, err := layertest.MakePipe(dialer, NewLayer(WithKeys(pub, priv)))()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if key := c1.(*connection).PeerKey(); *key != *pub {
+		t.Fatalf("peer key = %x, want %x", key, pub)
+	}
+}
+
+func TestUnauthorized(t *testing.T) {
+	other, _ := generateKey(t)
+	dialer := NewLayer(WithKeys(generateKey(t)), WithPeerKeys(other))
+	if _, _, _, err := layertest.MakePipe(dialer, NewLayer(WithKeys(generateKey(t))))(); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("dial error = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestImpersonation(t *testing.T) {
+	pub, priv := generateKey(t)
+	_, other := generateKey(t)
+	dialer := NewLayer(WithKeys(pub, other), WithPeerKeys(pub))
+	if _, _, _, err := layertest.MakePipe(dialer, NewLayer(WithKeys(pub, priv)))(); !errors.Is(err, ErrHandshake) {
+		t.Fatalf("dial error = %v, want %v", err, ErrHandshake)
+	}
+}
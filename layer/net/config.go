@@ -0,0 +1,47 @@
+package net
+
+import "github.com/crackcomm/onion"
+
+func init() {
+	onion.Register("net", FromParams, onion.LayerInfo{
+		Description: "Listens on TCP addresses and dials them if enabled",
+		Layer:       (*DialLayer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - Net layer parameters.
+type params struct {
+	Network string `yaml:"network" help:"network (default: tcp4)"`
+	Address string `yaml:"address" help:"listener address (default: 127.0.0.1)"`
+	Port    int    `yaml:"port" help:"listener port (default: random)"`
+	Dial    bool   `yaml:"dial" help:"dial directly"`
+}
+
+// FromParams - Creates a net layer from parameters:
+// network, address, port and dial.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.Network != "" {
+		opts = append(opts, WithNetwork(c.Network))
+	}
+	if c.Address != "" {
+		opts = append(opts, WithAddress(c.Address))
+	}
+	if c.Port != 0 {
+		opts = append(opts, WithPort(c.Port))
+	}
+	if c.Dial {
+		opts = append(opts, WithDial())
+	}
+	layer := newLayer(opts)
+	layer.params = p
+	return layer.onion(), nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
@@ -1,24 +1,39 @@
 // Package net implements net interface.
 //
-// Network layer is just used as listener for proxies like tor.
+// Network layer listens on local addresses. With WithDial option
+// it also dials TCP addresses, followed by proxies it dials the proxy.
 package net
 
 import (
 	"fmt"
 	"net"
 	"time"
+
+	"github.com/crackcomm/onion"
 )
 
 // Layer - Net layer.
 type Layer struct {
-	network  string
-	address  string
-	port     int
-	isDialer bool
+	network string
+	address string
+	port    int
+	dial    bool
+
+	params onion.Params
+}
+
+// DialLayer - Net layer which also dials TCP addresses.
+type DialLayer struct {
+	*Layer
 }
 
 // NewLayer - Creates a new net layer.
-func NewLayer(opts ...Option) (layer *Layer) {
+// It's a *DialLayer if dialing is enabled with WithDial, *Layer otherwise.
+func NewLayer(opts ...Option) onion.Layer {
+	return newLayer(opts).onion()
+}
+
+func newLayer(opts []Option) (layer *Layer) {
 	layer = &Layer{network: "tcp4", address: "127.0.0.1", port: 0}
 	for _, opt := range opts {
 		opt(layer)
@@ -26,13 +41,20 @@ func NewLayer(opts ...Option) (layer *Layer) {
 	return
 }
 
+// onion - Returns the layer or a dialing layer if dialing is enabled.
+func (layer *Layer) onion() onion.Layer {
+	if layer.dial {
+		return &DialLayer{Layer: layer}
+	}
+	return layer
+}
+
 // Name - Returns "net".
 func (layer *Layer) Name() string { return "net" }
 
-// Listener - Input should be empty.
-// It will return a listener on random port (or a specified port)
+// Listen - Returns a listener on random port (or a specified port)
 // on a tpc4 (or specified) network interface.
-func (layer *Layer) Listener(listener net.Listener) (net.Listener, error) {
+func (layer *Layer) Listen() (net.Listener, error) {
 	return net.Listen(layer.network, fmt.Sprintf("%s:%d", layer.address, layer.port))
 }
 
@@ -60,26 +82,17 @@ func WithNetwork(network string) Option {
 	}
 }
 
-// WithDial - Enables net Dial.
+// WithDial - Enables dialing TCP addresses.
+// Without it net layer only listens and other layers dial.
 func WithDial() Option {
 	return func(layer *Layer) {
-		layer.isDialer = true
+		layer.dial = true
 	}
 }
 
-// IsDialer - Returns false. Net layer is not a Dialer, this is a security package.
-func (layer *Layer) IsDialer() bool {
-	return layer.isDialer
-}
-
-// Dial - Dials
-func (layer *Layer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
-	return net.Dial("tcp", addr)
-}
-
-// Conn - Returns back the same connection.
-func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
-	return conn, nil
+// Dial - Dials TCP address.
+func (layer *DialLayer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", addr, timeout)
 }
 
 // Close - Does nothing.
@@ -0,0 +1,52 @@
+package net
+
+import (
+	"testing"
+	"time"
+
+	"github.com/crackcomm/onion"
+)
+
+func TestDialOptIn(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		layer func() (onion.Layer, error)
+		dial  bool
+	}{
+		{name: "default", layer: func() (onion.Layer, error) { return NewLayer(), nil }},
+		{name: "WithDial", layer: func() (onion.Layer, error) { return NewLayer(WithDial()), nil }, dial: true},
+		{name: "params", layer: func() (onion.Layer, error) { return FromParams(onion.Params{"port": 0}) }},
+		{name: "dial param", layer: func() (onion.Layer, error) { return FromParams(onion.Params{"dial": true}) }, dial: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			layer, err := test.layer()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := layer.(onion.Dialer); ok != test.dial {
+				t.Fatalf("layer is a dialer: %t, want %t", ok, test.dial)
+			}
+			if _, ok := layer.(onion.ListenerSource); !ok {
+				t.Fatal("layer is not a listener source")
+			}
+		})
+	}
+}
+
+func TestDial(t *testing.T) {
+	l, err := NewLayer().(*Layer).Listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	conn, err := NewLayer(WithDial()).(*DialLayer).Dial(l.Addr().String(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
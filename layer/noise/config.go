@@ -0,0 +1,70 @@
+package noise
+
+import (
+	"fmt"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/keys"
+)
+
+func init() {
+	onion.Register("noise", FromParams, onion.LayerInfo{
+		Description: "Encrypts streams with Noise protocol",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - Noise layer parameters.
+type params struct {
+	Pattern    Pattern       `yaml:"pattern" help:"handshake pattern: XX, IK or NK (default: XX)"`
+	PrivateKey string        `yaml:"private_key" help:"base64 static private key"`
+	RemoteKey  string        `yaml:"remote_key" help:"base64 responder static key (IK and NK)"`
+	Peers      onion.Strings `yaml:"peers" help:"base64 trusted peer static keys"`
+	Prologue   string        `yaml:"prologue" help:"handshake prologue"`
+}
+
+// FromParams - Creates a Noise layer from parameters:
+// pattern, private_key (base64 static key), remote_key,
+// peers (base64 peer static keys) and prologue.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.Pattern != "" {
+		if _, ok := patterns[c.Pattern]; !ok {
+			return nil, fmt.Errorf("noise: unknown pattern %q", c.Pattern)
+		}
+		opts = append(opts, WithPattern(c.Pattern))
+	}
+	if c.PrivateKey != "" {
+		pub, priv, err := keys.DecodePair(c.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithStaticKey(pub, priv))
+	}
+	if c.RemoteKey != "" {
+		key, err := keys.Decode(c.RemoteKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithRemoteKey(key))
+	}
+	peers, err := keys.DecodeAll(c.Peers)
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, WithPeerKeys(peers...))
+	if c.Prologue != "" {
+		opts = append(opts, WithPrologue([]byte(c.Prologue)))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
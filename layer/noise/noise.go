@@ -0,0 +1,274 @@
+// Package noise implements Noise Protocol Framework encryption layer.
+//
+// Handshakes use X25519, ChaChaPoly and BLAKE2s.
+// Supported patterns are XX (default), IK and NK.
+package noise
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	flynn "github.com/flynn/noise"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
+	"github.com/crackcomm/onion/internal/frame"
+)
+
+// Pattern - Noise handshake pattern name.
+type Pattern string
+
+const (
+	// XX - Both sides transmit static keys.
+	XX Pattern = "XX"
+
+	// IK - Initiator knows responder static key and transmits its own.
+	IK Pattern = "IK"
+
+	// NK - Initiator knows responder static key and stays anonymous.
+	NK Pattern = "NK"
+)
+
+var patterns = map[Pattern]flynn.HandshakePattern{
+	XX: flynn.HandshakeXX,
+	IK: flynn.HandshakeIK,
+	NK: flynn.HandshakeNK,
+}
+
+var suite = flynn.NewCipherSuite(flynn.DH25519, flynn.CipherChaChaPoly, flynn.HashBLAKE2s)
+
+// ErrUnauthorized - Peer static key is not trusted.
+var ErrUnauthorized = errors.New("noise: peer key not allowed")
+
+// Layer - Noise Layer.
+type Layer struct {
+	pattern  Pattern
+	pub      *[32]byte
+	priv     *[32]byte
+	remote   *[32]byte
+	peers    []*[32]byte
+	prologue []byte
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new Noise layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{pattern: XX}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// GenerateKey - Generates a new X25519 static key pair.
+// Uses crypto/rand if rand is nil.
+func GenerateKey(random io.Reader) (pub, priv *[32]byte, err error) {
+	if random == nil {
+		random = rand.Reader
+	}
+	key, err := flynn.DH25519.GenerateKeypair(random)
+	if err != nil {
+		return
+	}
+	pub, priv = new([32]byte), new([32]byte)
+	copy(pub[:], key.Public)
+	copy(priv[:], key.Private)
+	return
+}
+
+// Name - Returns "noise".
+func (layer *Layer) Name() string { return "noise" }
+
+// Listener - Wraps listener with a Noise layer.
+// Handshakes of accepted connections run concurrently with a deadline.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	if _, ok := patterns[layer.pattern]; !ok {
+		return nil, fmt.Errorf("noise: unsupported pattern %q", layer.pattern)
+	}
+	return accept.NewListener(l, "noise", func(conn net.Conn) (net.Conn, error) {
+		return layer.handshake(conn, false)
+	}), nil
+}
+
+// Conn - Performs a handshake as initiator and wraps the connection.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	return layer.handshake(conn, true)
+}
+
+// handshake - Performs a Noise handshake and verifies peer static key.
+func (layer *Layer) handshake(conn net.Conn, initiator bool) (net.Conn, error) {
+	pattern, ok := patterns[layer.pattern]
+	if !ok {
+		return nil, fmt.Errorf("noise: unsupported pattern %q", layer.pattern)
+	}
+
+	config := flynn.Config{
+		CipherSuite: suite,
+		Random:      rand.Reader,
+		Pattern:     pattern,
+		Initiator:   initiator,
+		Prologue:    layer.prologue,
+	}
+	if layer.priv != nil {
+		config.StaticKeypair = flynn.DHKey{Private: layer.priv[:], Public: layer.pub[:]}
+	} else if !initiator || layer.pattern != NK {
+		return nil, errors.New("noise: static key is not set")
+	}
+	if initiator && layer.pattern != XX {
+		if layer.remote == nil {
+			return nil, fmt.Errorf("noise: remote key is required in %s pattern", layer.pattern)
+		}
+		config.PeerStatic = layer.remote[:]
+	}
+
+	hs, err := flynn.NewHandshakeState(config)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		send, recv *flynn.CipherState
+		write      = initiator
+	)
+	for send == nil {
+		var cs1, cs2 *flynn.CipherState
+		if write {
+			var msg []byte
+			msg, cs1, cs2, err = hs.WriteMessage(nil, nil)
+			if err == nil {
+				err = frame.Write(conn, msg)
+			}
+		} else {
+			var msg []byte
+			msg, err = frame.Read(conn)
+			if err == nil {
+				_, cs1, cs2, err = hs.ReadMessage(nil, msg)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if cs1 != nil {
+			if initiator {
+				send, recv = cs1, cs2
+			} else {
+				send, recv = cs2, cs1
+			}
+		}
+		write = !write
+	}
+
+	peer, err := layer.verify(hs.PeerStatic())
+	if err != nil {
+		return nil, err
+	}
+
+	return &connection{
+		Conn: frame.NewConn(conn, &cipher{send}, &cipher{recv}),
+		peer: peer,
+	}, nil
+}
+
+// verify - Verifies peer static key if peer keys are set.
+func (layer *Layer) verify(static []byte) (*[32]byte, error) {
+	var peer *[32]byte
+	if len(static) == 32 {
+		peer = new([32]byte)
+		copy(peer[:], static)
+	}
+	if len(layer.peers) == 0 {
+		return peer, nil
+	}
+	if peer == nil {
+		return nil, ErrUnauthorized
+	}
+	for _, key := range layer.peers {
+		if subtle.ConstantTimeCompare(key[:], peer[:]) == 1 {
+			return peer, nil
+		}
+	}
+	return nil, ErrUnauthorized
+}
+
+// Option - Noise layer option.
+type Option func(*Layer)
+
+// WithPattern - Sets handshake pattern (default: XX).
+func WithPattern(pattern Pattern) Option {
+	return func(layer *Layer) {
+		layer.pattern = pattern
+	}
+}
+
+// WithStaticKey - Sets our static key pair.
+func WithStaticKey(pub, priv *[32]byte) Option {
+	return func(layer *Layer) {
+		layer.pub = pub
+		layer.priv = priv
+	}
+}
+
+// WithRemoteKey - Sets responder static key.
+// Required on the dialing side in IK and NK patterns.
+func WithRemoteKey(key *[32]byte) Option {
+	return func(layer *Layer) {
+		layer.remote = key
+	}
+}
+
+// WithPeerKeys - Adds trusted peer static keys.
+// If none are set any peer is accepted.
+func WithPeerKeys(keys ...*[32]byte) Option {
+	return func(layer *Layer) {
+		layer.peers = append(layer.peers, keys...)
+	}
+}
+
+// WithPrologue - Sets handshake prologue, both sides have to use the same.
+func WithPrologue(prologue []byte) Option {
+	return func(layer *Layer) {
+		layer.prologue = prologue
+	}
+}
+
+// connection - Connection encrypted with Noise transport keys.
+type connection struct {
+	*frame.Conn
+	peer *[32]byte
+}
+
+// PeerKey - Returns peer static key or nil if peer didn't send one.
+func (conn *connection) PeerKey() *[32]byte {
+	return conn.peer
+}
+
+// cipher - Noise cipher state used as frame cipher.
+type cipher struct {
+	*flynn.CipherState
+}
+
+func (c *cipher) Seal(plaintext []byte) ([]byte, error) {
+	return c.Encrypt(nil, nil, plaintext)
+}
+
+func (c *cipher) Open(ciphertext []byte) ([]byte, error) {
+	return c.Decrypt(nil, nil, ciphertext)
+}
+
+func (c *cipher) Rewind() {
+	c.SetNonce(c.Nonce() - 1)
+}
+
+func (c *cipher) Overhead() int {
+	return 16
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
@@ -0,0 +1,82 @@
+package noise
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/layertest"
+)
+
+func generateKey(t *testing.T) (pub, priv *[32]byte) {
+	pub, priv, err := GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestConn(t *testing.T) {
+	client, server := WithStaticKey(generateKey(t)), WithStaticKey(generateKey(t))
+	layertest.TestConn(t, NewLayer(client), NewLayer(server))
+}
+
+func TestConnIK(t *testing.T) {
+	pub, priv := generateKey(t)
+	layertest.TestConn(t,
+		NewLayer(WithPattern(IK), WithStaticKey(generateKey(t)), WithRemoteKey(pub)),
+		NewLayer(WithPattern(IK), WithStaticKey(pub, priv)),
+	)
+}
+
+func TestConnNK(t *testing.T) {
+	pub, priv := generateKey(t)
+	layertest.TestConn(t,
+		NewLayer(WithPattern(NK), WithRemoteKey(pub)),
+		NewLayer(WithPattern(NK), WithStaticKey(pub, priv)),
+	)
+}
+
+func TestUnauthorized(t *testing.T) {
+	other, _ := generateKey(t)
+	dialer := NewLayer(WithStaticKey(generateKey(t)), WithPeerKeys(other))
+	listener := NewLayer(WithStaticKey(generateKey(t)))
+	if _, _, _, err := layertest.MakePipe(dialer, listener)(); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("dial error = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestTruncated(t *testing.T) {
+	layer := NewLayer(WithStaticKey(generateKey(t)))
+	for _, test := range []struct {
+		name  string
+		close func(net.Conn) error
+		err   error
+	}{
+		{name: "close", close: net.Conn.Close},
+		{name: "truncated", close: func(conn net.Conn) error {
+			return conn.(onion.WrappedConn).NetConn().Close()
+		}, err: io.ErrUnexpectedEOF},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c1, c2, stop, err := layertest.MakePipe(layer, layer)()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+			if _, err := c2.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			if err := test.close(c2); err != nil {
+				t.Fatal(err)
+			}
+			b, err := ioutil.ReadAll(c1)
+			if string(b) != "hello" || !errors.Is(err, test.err) {
+				t.Fatalf("read %q, %v, want %q, %v", b, err, "hello", test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package pad
+
+import (
+	"time"
+
+	"github.com/crackcomm/onion"
+)
+
+func init() {
+	onion.Register("pad", FromParams, onion.LayerInfo{
+		Description: "Pads streams into fixed size cells with optional cover traffic",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - Padding layer parameters.
+type params struct {
+	CellSize int           `yaml:"cell_size" help:"size of all cells (default: 512)"`
+	Buckets  []int         `yaml:"buckets" help:"cell sizes, smallest fitting the data is used"`
+	Cover    time.Duration `yaml:"cover" help:"average interval of cover traffic"`
+	Rate     time.Duration `yaml:"rate" help:"constant interval of sent cells"`
+}
+
+// FromParams - Creates a padding layer from parameters:
+// cell_size, buckets, cover and rate (durations like "50ms").
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.CellSize != 0 {
+		opts = append(opts, WithCellSize(c.CellSize))
+	}
+	if len(c.Buckets) > 0 {
+		opts = append(opts, WithBuckets(c.Buckets...))
+	}
+	if c.Cover != 0 {
+		opts = append(opts, WithCover(c.Cover))
+	}
+	if c.Rate != 0 {
+		opts = append(opts, WithRate(c.Rate))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
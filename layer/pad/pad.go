@@ -0,0 +1,376 @@
+// Package pad implements traffic padding layer.
+//
+// Data is sent in cells of fixed size or of the smallest fitting bucket size.
+// Every cell is a frame with a 1 byte type, 2 byte big-endian payload length,
+// the payload and zero padding. Padding cells are sent as cover traffic
+// when connection is idle or at a constant rate and dropped by the peer.
+// Close cell stops padding of the peer which replies with a close cell,
+// so unread padding doesn't reset the connection on close.
+//
+// Padding layer has to be listed after encryption layers in an onion,
+// so cells are encrypted and length of the payload is hidden.
+package pad
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/async"
+	"github.com/crackcomm/onion/internal/frame"
+)
+
+// DefaultCellSize - Default size of a cell.
+const DefaultCellSize = 512
+
+// headerSize - Size of cell type and payload length.
+const headerSize = 3
+
+// closeTimeout - Time limit for close cell of the peer on Shutdown.
+const closeTimeout = time.Second
+
+const (
+	cellData    = 1
+	cellPadding = 2
+	cellClose   = 3
+)
+
+// ErrCell - Received malformed cell.
+var ErrCell = errors.New("pad: malformed cell")
+
+// Layer - Padding Layer.
+type Layer struct {
+	buckets []int
+	cover   time.Duration
+	rate    time.Duration
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new padding layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{buckets: []int{DefaultCellSize}}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// Name - Returns "pad".
+func (layer *Layer) Name() string { return "pad" }
+
+// Listener - Wraps listener with a padding layer.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	return &listener{
+		Listener: l,
+		layer:    layer,
+	}, nil
+}
+
+// Conn - Wraps the connection with a padding layer.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	return async.NewConn(conn, newStream(conn, layer)), nil
+}
+
+// Option - Padding layer option.
+type Option func(*Layer)
+
+// WithCellSize - Sends all cells of the same size (default: 512).
+// Size includes 3 bytes of cell header.
+func WithCellSize(size int) Option {
+	return WithBuckets(size)
+}
+
+// WithBuckets - Sends cells of the smallest size fitting the data.
+// Data larger than the largest size is split into multiple cells.
+// Sizes include 3 bytes of cell header and can't exceed frame size of 65535.
+func WithBuckets(sizes ...int) Option {
+	return func(layer *Layer) {
+		layer.buckets = nil
+		for _, size := range sizes {
+			if size > headerSize && size <= frame.MaxSize {
+				layer.buckets = append(layer.buckets, size)
+			}
+		}
+		if len(layer.buckets) == 0 {
+			layer.buckets = []int{DefaultCellSize}
+		}
+		sort.Ints(layer.buckets)
+	}
+}
+
+// WithCover - Sends a padding cell after random idle time
+// averaging the interval.
+func WithCover(interval time.Duration) Option {
+	return func(layer *Layer) {
+		layer.cover = interval
+	}
+}
+
+// WithRate - Sends exactly one cell every interval,
+// a padding cell if there is no data to send.
+// Data is queued until the next interval. Overrides cover traffic.
+func WithRate(interval time.Duration) Option {
+	return func(layer *Layer) {
+		layer.rate = interval
+	}
+}
+
+// listener - Padding layer listener.
+type listener struct {
+	net.Listener
+	layer *Layer
+}
+
+// Accept - Accepts connection and wraps it with a padding layer.
+func (listener *listener) Accept() (net.Conn, error) {
+	conn, err := listener.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return listener.layer.Conn(conn)
+}
+
+// cell - Cell queued for sending.
+type cell struct {
+	body []byte
+	err  chan error
+}
+
+// stream - Padded stream. Cells are written only by the sending goroutine.
+type stream struct {
+	conn  net.Conn
+	layer *Layer
+
+	cells  chan *cell
+	err    error
+	once   *sync.Once
+	stop   chan struct{}
+	exited chan struct{}
+
+	// closed by Receive on peer close cell
+	peerOnce   *sync.Once
+	peerClosed chan struct{}
+}
+
+func newStream(conn net.Conn, layer *Layer) *stream {
+	s := &stream{
+		conn:   conn,
+		layer:  layer,
+		cells:  make(chan *cell),
+		once:   new(sync.Once),
+		stop:   make(chan struct{}),
+		exited: make(chan struct{}),
+
+		peerOnce:   new(sync.Once),
+		peerClosed: make(chan struct{}),
+	}
+	go s.sendLoop()
+	return s
+}
+
+// Receive - Returns payload of next data cell, drops padding cells.
+// Returns io.EOF on close cell.
+func (s *stream) Receive() ([]byte, error) {
+	for {
+		body, err := frame.Read(s.conn)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) < headerSize {
+			return nil, ErrCell
+		}
+		size := int(binary.BigEndian.Uint16(body[1:]))
+		if size > len(body)-headerSize {
+			return nil, ErrCell
+		}
+		switch body[0] {
+		case cellData:
+			if size > 0 {
+				return body[headerSize : headerSize+size], nil
+			}
+		case cellPadding:
+		case cellClose:
+			s.peerOnce.Do(func() { close(s.peerClosed) })
+			return nil, io.EOF
+		default:
+			return nil, ErrCell
+		}
+	}
+}
+
+// Send - Splits data into cells and waits until they are sent.
+func (s *stream) Send(b []byte) error {
+	max := s.layer.buckets[len(s.layer.buckets)-1] - headerSize
+	for len(b) > 0 {
+		n := len(b)
+		if n > max {
+			n = max
+		}
+		c := &cell{body: s.encode(cellData, b[:n]), err: make(chan error, 1)}
+		select {
+		case s.cells <- c:
+		case <-s.exited:
+			return s.exitErr()
+		}
+		if err := <-c.err; err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// Shutdown - Sends a close cell and waits for close cell of the peer.
+func (s *stream) Shutdown() error {
+	s.once.Do(func() { close(s.stop) })
+	<-s.exited
+	if s.err != nil {
+		return s.err
+	}
+	select {
+	case <-s.peerClosed:
+	case <-time.After(closeTimeout):
+	}
+	return nil
+}
+
+// Release - Stops the sending goroutine.
+func (s *stream) Release() {
+	s.once.Do(func() { close(s.stop) })
+	<-s.exited
+}
+
+func (s *stream) exitErr() error {
+	if s.err != nil {
+		return s.err
+	}
+	return net.ErrClosed
+}
+
+// encode - Returns cell of the smallest fitting size.
+func (s *stream) encode(typ byte, payload []byte) []byte {
+	size := s.layer.buckets[len(s.layer.buckets)-1]
+	for _, bucket := range s.layer.buckets {
+		if bucket >= len(payload)+headerSize {
+			size = bucket
+			break
+		}
+	}
+	body := make([]byte, size)
+	body[0] = typ
+	binary.BigEndian.PutUint16(body[1:], uint16(len(payload)))
+	copy(body[headerSize:], payload)
+	return body
+}
+
+// padding - Returns padding cell of random bucket size.
+func (s *stream) padding(typ byte) []byte {
+	size := s.layer.buckets[rand.Intn(len(s.layer.buckets))]
+	body := make([]byte, size)
+	body[0] = typ
+	return body
+}
+
+// sendLoop - Writes data cells and padding cells until stopped or write fails.
+// Sends a close cell when stopped or when peer closed, padding stops then.
+func (s *stream) sendLoop() {
+	defer close(s.exited)
+
+	var (
+		timer *time.Timer
+		tick  <-chan time.Time
+		rate  = s.layer.rate > 0
+	)
+	switch {
+	case rate:
+		ticker := time.NewTicker(s.layer.rate)
+		defer ticker.Stop()
+		tick = ticker.C
+	case s.layer.cover > 0:
+		timer = time.NewTimer(s.coverDelay())
+		defer timer.Stop()
+		tick = timer.C
+	}
+
+	peerClosed := s.peerClosed
+	for {
+		var c *cell
+		if rate {
+			select {
+			case <-tick:
+			case <-peerClosed:
+			case <-s.stop:
+			}
+			select {
+			case c = <-s.cells:
+			default:
+			}
+		} else {
+			select {
+			case c = <-s.cells:
+			case <-tick:
+			case <-peerClosed:
+			case <-s.stop:
+			}
+		}
+
+		if c == nil && (isClosed(s.stop) || isClosed(peerClosed)) {
+			if peerClosed != nil {
+				if s.err = frame.Write(s.conn, s.padding(cellClose)); s.err != nil {
+					return
+				}
+			}
+			if isClosed(s.stop) {
+				return
+			}
+			// peer closed, send only data from now on
+			peerClosed, tick, timer, rate = nil, nil, nil, false
+			continue
+		}
+
+		var err error
+		if c != nil {
+			err = frame.Write(s.conn, c.body)
+			c.err <- err
+		} else {
+			err = frame.Write(s.conn, s.padding(cellPadding))
+		}
+		if err != nil {
+			s.err = err
+			return
+		}
+
+		if timer != nil {
+			if c != nil && !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(s.coverDelay())
+		}
+	}
+}
+
+func isClosed(c chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+		return false
+	}
+}
+
+// coverDelay - Returns random delay of next padding cell.
+func (s *stream) coverDelay() time.Duration {
+	return time.Duration(rand.Int63n(2*int64(s.layer.cover))) + 1
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
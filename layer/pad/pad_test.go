@@ -0,0 +1,77 @@
+package pad
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/onion/internal/frame"
+	"github.com/crackcomm/onion/layertest"
+)
+
+func TestConn(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		layer *Layer
+	}{
+		{name: "cell", layer: NewLayer()},
+		{name: "buckets", layer: NewLayer(WithBuckets(64, 512, 4096))},
+		{name: "cover", layer: NewLayer(WithCover(time.Millisecond))},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			layertest.TestConn(t, test.layer, test.layer)
+		})
+	}
+}
+
+// cells - Returns padded connection and raw peer connection.
+func cells(t *testing.T, layer *Layer) (conn, raw net.Conn) {
+	c1, c2 := net.Pipe()
+	conn, err := layer.Conn(c1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c2.Close()
+		conn.Close()
+	})
+	return conn, c2
+}
+
+func TestBuckets(t *testing.T) {
+	conn, raw := cells(t, NewLayer(WithBuckets(256, 64)))
+	for _, test := range []struct {
+		size  int
+		cells []int
+	}{
+		{size: 2, cells: []int{64}},
+		{size: 61, cells: []int{64}},
+		{size: 62, cells: []int{256}},
+		{size: 300, cells: []int{256, 64}},
+	} {
+		go conn.Write(make([]byte, test.size))
+		for _, size := range test.cells {
+			body, err := frame.Read(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(body) != size || body[0] != cellData {
+				t.Fatalf("write of %d bytes: cell of type %d and size %d, want data cells %v", test.size, body[0], len(body), test.cells)
+			}
+		}
+	}
+}
+
+func TestCover(t *testing.T) {
+	_, raw := cells(t, NewLayer(WithCellSize(128), WithCover(time.Millisecond)))
+	raw.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for i := 0; i < 3; i++ {
+		body, err := frame.Read(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(body) != 128 || body[0] != cellPadding {
+			t.Fatalf("cell of type %d and size %d, want padding cell of size 128", body[0], len(body))
+		}
+	}
+}
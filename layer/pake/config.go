@@ -0,0 +1,35 @@
+package pake
+
+import "github.com/crackcomm/onion"
+
+func init() {
+	onion.Register("pake", FromParams, onion.LayerInfo{
+		Description: "Authenticates peers with a password",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - PAKE layer parameters.
+type params struct {
+	Password string `yaml:"password" help:"shared password" required:"true"`
+	Context  string `yaml:"context" help:"context binding the key exchange"`
+}
+
+// FromParams - Creates a PAKE layer from parameters: password and context.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	opts := []Option{WithPassword(c.Password)}
+	if c.Context != "" {
+		opts = append(opts, WithContext([]byte(c.Context)))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
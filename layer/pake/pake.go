@@ -0,0 +1,226 @@
+// Package pake implements password-authenticated key exchange layer.
+//
+// Key exchange follows CPace construction over ristretto255:
+//
+//  1. Both sides exchange random session id halves.
+//  2. Generator is derived by hashing the password with the session id.
+//  3. Both sides send y*G for random y and compute shared point.
+//  4. Session keys are derived with HKDF-SHA256 from a hash of the
+//     session id, shared point and transcript.
+//  5. Both sides prove knowledge of the keys with an HMAC of their role.
+//
+// An attacker can verify at most one password guess per connection,
+// messages give no material for offline dictionary attacks.
+// Stream is encrypted with ChaCha20-Poly1305 using a key per direction.
+package pake
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/gtank/ristretto255"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
+	"github.com/crackcomm/onion/internal/frame"
+)
+
+const (
+	sidSize     = 16
+	elementSize = 32
+
+	dsi    = "CPaceRistretto255"
+	dsiISK = "CPaceRistretto255_ISK"
+	info   = "onion pake v1"
+)
+
+// ErrAuth - Key exchange failed, most likely because of a wrong password.
+var ErrAuth = errors.New("pake: authentication failed")
+
+// Layer - Password-authenticated key exchange Layer.
+type Layer struct {
+	password []byte
+	context  []byte
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new PAKE layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// Name - Returns "pake".
+func (layer *Layer) Name() string { return "pake" }
+
+// Listener - Wraps listener with a PAKE layer.
+// Handshakes of accepted connections run concurrently with a deadline.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	return accept.NewListener(l, "pake", func(conn net.Conn) (net.Conn, error) {
+		return layer.handshake(conn, false)
+	}), nil
+}
+
+// Conn - Performs a key exchange and wraps the connection.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	return layer.handshake(conn, true)
+}
+
+// handshake - Performs CPace key exchange and key confirmation.
+func (layer *Layer) handshake(conn net.Conn, initiator bool) (net.Conn, error) {
+	if len(layer.password) == 0 {
+		return nil, errors.New("pake: password is not set")
+	}
+
+	half := make([]byte, sidSize)
+	if _, err := io.ReadFull(rand.Reader, half); err != nil {
+		return nil, err
+	}
+	peerHalf, err := frame.Exchange(conn, half)
+	if err != nil {
+		return nil, err
+	}
+	if len(peerHalf) != sidSize {
+		return nil, ErrAuth
+	}
+	sid := ordered(initiator, half, peerHalf)
+
+	seed := make([]byte, 64)
+	if _, err := io.ReadFull(rand.Reader, seed); err != nil {
+		return nil, err
+	}
+	y := ristretto255.NewScalar().FromUniformBytes(seed)
+	g := layer.generator(sid)
+	our := ristretto255.NewElement().ScalarMult(y, g).Encode(nil)
+
+	msg, err := frame.Exchange(conn, our)
+	if err != nil {
+		return nil, err
+	}
+	peer := ristretto255.NewElement()
+	if len(msg) != elementSize || peer.Decode(msg) != nil {
+		return nil, ErrAuth
+	}
+	identity := ristretto255.NewElement().Zero()
+	if peer.Equal(identity) == 1 {
+		return nil, ErrAuth
+	}
+	k := ristretto255.NewElement().ScalarMult(y, peer)
+	if k.Equal(identity) == 1 {
+		return nil, ErrAuth
+	}
+
+	h := sha512.New()
+	h.Write(prependLen([]byte(dsiISK)))
+	h.Write(prependLen(sid))
+	h.Write(prependLen(k.Encode(nil)))
+	transcript := ordered(initiator, our, msg)
+	h.Write(prependLen(transcript[:elementSize]))
+	h.Write(prependLen(transcript[elementSize:]))
+	isk := h.Sum(nil)
+
+	kdf := hkdf.New(sha256.New, isk, sid, []byte(info))
+	keys := make([]byte, 3*chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(kdf, keys); err != nil {
+		return nil, err
+	}
+	initKey, respKey, authKey := keys[:32], keys[32:64], keys[64:]
+
+	role, peerRole := "initiator", "responder"
+	if !initiator {
+		role, peerRole = peerRole, role
+	}
+	proof, err := frame.Exchange(conn, mac(authKey, role, transcript))
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(proof, mac(authKey, peerRole, transcript)) {
+		return nil, ErrAuth
+	}
+
+	sendKey, recvKey := initKey, respKey
+	if !initiator {
+		sendKey, recvKey = respKey, initKey
+	}
+	send, err := chacha20poly1305.New(sendKey)
+	if err != nil {
+		return nil, err
+	}
+	recv, err := chacha20poly1305.New(recvKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i] = 0
+	}
+	return frame.NewConn(conn, frame.NewAEAD(send), frame.NewAEAD(recv)), nil
+}
+
+// generator - Derives generator from password, context and session id.
+func (layer *Layer) generator(sid []byte) *ristretto255.Element {
+	h := sha512.New()
+	h.Write(prependLen([]byte(dsi)))
+	h.Write(prependLen(layer.password))
+	h.Write(prependLen(layer.context))
+	h.Write(prependLen(sid))
+	return ristretto255.NewElement().FromUniformBytes(h.Sum(nil))
+}
+
+// ordered - Returns initiator value followed by responder value.
+func ordered(initiator bool, our, peer []byte) []byte {
+	b := make([]byte, 0, len(our)+len(peer))
+	if initiator {
+		return append(append(b, our...), peer...)
+	}
+	return append(append(b, peer...), our...)
+}
+
+// prependLen - Prepends LEB128 encoded length.
+func prependLen(b []byte) []byte {
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(b))
+	n := binary.PutUvarint(buf, uint64(len(b)))
+	return append(buf[:n], b...)
+}
+
+// mac - Returns key confirmation for a role.
+func mac(key []byte, role string, transcript []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(role))
+	h.Write(transcript)
+	return h.Sum(nil)
+}
+
+// Option - PAKE layer option.
+type Option func(*Layer)
+
+// WithPassword - Sets password.
+func WithPassword(password string) Option {
+	return func(layer *Layer) {
+		layer.password = []byte(password)
+	}
+}
+
+// WithContext - Sets context binding key exchange to an application
+// or a channel, both sides have to use the same.
+func WithContext(context []byte) Option {
+	return func(layer *Layer) {
+		layer.context = context
+	}
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
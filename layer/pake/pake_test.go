@@ -0,0 +1,38 @@
+package pake
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crackcomm/onion/layertest"
+)
+
+func TestConn(t *testing.T) {
+	layer := NewLayer(WithPassword("correct horse battery staple"), WithContext([]byte("test")))
+	layertest.TestConn(t, layer, layer)
+}
+
+func TestWrongPassword(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		dialer   *Layer
+		listener *Layer
+	}{
+		{
+			name:     "password",
+			dialer:   NewLayer(WithPassword("correct horse battery staple")),
+			listener: NewLayer(WithPassword("incorrect horse battery staple")),
+		},
+		{
+			name:     "context",
+			dialer:   NewLayer(WithPassword("correct horse battery staple"), WithContext([]byte("a"))),
+			listener: NewLayer(WithPassword("correct horse battery staple"), WithContext([]byte("b"))),
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if _, _, _, err := layertest.MakePipe(test.dialer, test.listener)(); !errors.Is(err, ErrAuth) {
+				t.Fatalf("dial error = %v, want %v", err, ErrAuth)
+			}
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package psk
+
+import (
+	"errors"
+	"io/ioutil"
+
+	"github.com/crackcomm/onion"
+)
+
+func init() {
+	onion.Register("psk", FromParams, onion.LayerInfo{
+		Description: "Authenticates and encrypts streams with a pre-shared key",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - Pre-shared key layer parameters.
+type params struct {
+	Secret     string `yaml:"secret" help:"shared secret"`
+	SecretFile string `yaml:"secret_file" help:"file with the shared secret"`
+}
+
+// FromParams - Creates a pre-shared key layer from parameters:
+// secret or secret_file (file with the secret), one of them is required.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	secret := []byte(c.Secret)
+	if c.SecretFile != "" {
+		body, err := ioutil.ReadFile(c.SecretFile)
+		if err != nil {
+			return nil, err
+		}
+		secret = body
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("psk: secret is not set")
+	}
+	layer := NewLayer(WithSecret(secret))
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
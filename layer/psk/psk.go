@@ -0,0 +1,156 @@
+// Package psk implements pre-shared key encryption layer.
+//
+// Both sides send 32 random bytes. Session keys are derived with
+// HKDF-SHA256 from the shared secret salted with both random values.
+// Each side proves possession of the secret with an HMAC of its role,
+// then the stream is encrypted with ChaCha20-Poly1305 using a key
+// per direction and counter nonces.
+package psk
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/golang/glog"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
+	"github.com/crackcomm/onion/internal/frame"
+)
+
+const (
+	nonceSize = 32
+	info      = "onion psk v1"
+)
+
+// MinSecretSize - Recommended minimum size of the shared secret.
+const MinSecretSize = 32
+
+// ErrAuth - Peer did not prove possession of the shared secret.
+var ErrAuth = errors.New("psk: authentication failed")
+
+// Layer - Pre-shared key Layer.
+type Layer struct {
+	secret []byte
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new pre-shared key layer.
+// Logs a warning if the secret is shorter than MinSecretSize.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	if n := len(layer.secret); n > 0 && n < MinSecretSize {
+		glog.Warningf("[psk] secret has %d bytes, it should be at least %d random bytes", n, MinSecretSize)
+	}
+	return
+}
+
+// Name - Returns "psk".
+func (layer *Layer) Name() string { return "psk" }
+
+// Listener - Wraps listener with a pre-shared key layer.
+// Handshakes of accepted connections run concurrently with a deadline.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	return accept.NewListener(l, "psk", func(conn net.Conn) (net.Conn, error) {
+		return layer.handshake(conn, false)
+	}), nil
+}
+
+// Conn - Authenticates the peer and wraps the connection.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	return layer.handshake(conn, true)
+}
+
+// handshake - Exchanges random nonces, derives keys and proves possession of the secret.
+func (layer *Layer) handshake(conn net.Conn, initiator bool) (net.Conn, error) {
+	if len(layer.secret) == 0 {
+		return nil, errors.New("psk: secret is not set")
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	peerNonce, err := frame.Exchange(conn, nonce)
+	if err != nil {
+		return nil, err
+	}
+	if len(peerNonce) != nonceSize {
+		return nil, ErrAuth
+	}
+
+	salt := make([]byte, 0, 2*nonceSize)
+	if initiator {
+		salt = append(append(salt, nonce...), peerNonce...)
+	} else {
+		salt = append(append(salt, peerNonce...), nonce...)
+	}
+	kdf := hkdf.New(sha256.New, layer.secret, salt, []byte(info))
+	keys := make([]byte, 3*chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(kdf, keys); err != nil {
+		return nil, err
+	}
+	initKey, respKey, authKey := keys[:32], keys[32:64], keys[64:]
+
+	role, peerRole := "initiator", "responder"
+	if !initiator {
+		role, peerRole = peerRole, role
+	}
+	proof, err := frame.Exchange(conn, mac(authKey, role, salt))
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(proof, mac(authKey, peerRole, salt)) {
+		return nil, ErrAuth
+	}
+
+	sendKey, recvKey := initKey, respKey
+	if !initiator {
+		sendKey, recvKey = respKey, initKey
+	}
+	send, err := chacha20poly1305.New(sendKey)
+	if err != nil {
+		return nil, err
+	}
+	recv, err := chacha20poly1305.New(recvKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i] = 0
+	}
+	return frame.NewConn(conn, frame.NewAEAD(send), frame.NewAEAD(recv)), nil
+}
+
+// mac - Returns proof of possession of the secret for a role.
+func mac(key []byte, role string, transcript []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(role))
+	h.Write(transcript)
+	return h.Sum(nil)
+}
+
+// Option - Pre-shared key layer option.
+type Option func(*Layer)
+
+// WithSecret - Sets shared secret. It should be at least MinSecretSize random bytes.
+func WithSecret(secret []byte) Option {
+	return func(layer *Layer) {
+		layer.secret = secret
+	}
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
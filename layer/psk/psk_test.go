@@ -0,0 +1,44 @@
+package psk
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/layertest"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+func TestConn(t *testing.T) {
+	layer := NewLayer(WithSecret(secret))
+	layertest.TestConn(t, layer, layer)
+}
+
+func TestWrongSecret(t *testing.T) {
+	other := NewLayer(WithSecret([]byte("fedcba9876543210fedcba9876543210")))
+	if _, _, _, err := layertest.MakePipe(NewLayer(WithSecret(secret)), other)(); !errors.Is(err, ErrAuth) {
+		t.Fatalf("dial error = %v, want %v", err, ErrAuth)
+	}
+}
+
+func TestFromParams(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		params onion.Params
+		err    bool
+	}{
+		{name: "secret", params: onion.Params{"secret": string(secret)}},
+		{name: "empty", params: onion.Params{}, err: true},
+		{name: "empty secret", params: onion.Params{"secret": ""}, err: true},
+		{name: "missing file", params: onion.Params{"secret_file": "/nonexistent"}, err: true},
+		{name: "unknown", params: onion.Params{"key": "value"}, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := FromParams(test.params)
+			if (err != nil) != test.err {
+				t.Fatalf("FromParams(%v) error = %v, want error %t", test.params, err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package sch
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net"
+
+	"github.com/crackcomm/onion"
+)
+
+// ErrUnauthorized - Peer key is not allowed.
+var ErrUnauthorized = errors.New("sch: peer key not allowed")
+
+// ErrNoChannel - Connection is not wrapped with a Schannel layer.
+var ErrNoChannel = errors.New("sch: no schannel connection")
+
+// AllowKeys - Returns an authorizer that accepts peers
+// authenticated by the outermost Schannel layer with one of the keys.
+func AllowKeys(keys ...*[32]byte) onion.Authorizer {
+	return onion.AuthorizerFunc(func(conn net.Conn) error {
+		peer := PeerKey(conn)
+		if peer == nil {
+			return ErrNoChannel
+		}
+		for _, key := range keys {
+			if subtle.ConstantTimeCompare(key[:], peer[:]) == 1 {
+				return nil
+			}
+		}
+		return ErrUnauthorized
+	})
+}
+
+// PeerKey - Returns peer public key of the outermost Schannel
+// connection in the onion or nil if there is none.
+func PeerKey(conn net.Conn) (key *[32]byte) {
+	onion.Walk(conn, func(c net.Conn) bool {
+		if sc, ok := c.(*connection); ok {
+			key = sc.PeerKey()
+			return false
+		}
+		return true
+	})
+	return
+}
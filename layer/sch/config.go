@@ -0,0 +1,62 @@
+package sch
+
+import "github.com/crackcomm/onion"
+
+func init() {
+	onion.Register("sch", FromParams, onion.LayerInfo{
+		Description: "Encrypts streams with Schannel",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - Schannel layer parameters.
+type params struct {
+	Keys       string        `yaml:"keys" help:"key files prefix, .pub and .key are appended"`
+	PubKey     string        `yaml:"pub_key" help:"public key file"`
+	PrivKey    string        `yaml:"priv_key" help:"private key file"`
+	Peers      onion.Strings `yaml:"peers" help:"trusted peer public key files"`
+	KnownHosts string        `yaml:"known_hosts" help:"known hosts file"`
+}
+
+// FromParams - Creates a Schannel layer from parameters:
+// keys (key files prefix, ".pub" and ".key" are appended),
+// pub_key and priv_key (key files), peers (peer public key files)
+// and known_hosts (known hosts file).
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	if c.Keys != "" {
+		c.PubKey, c.PrivKey = c.Keys+".pub", c.Keys+".key"
+	}
+	var opts []Option
+	if c.PubKey != "" || c.PrivKey != "" {
+		opt, err := WithKeyFiles(c.PubKey, c.PrivKey)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+	for _, filename := range c.Peers {
+		key, err := ReadPublicKeyFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithPeerKeys(key))
+	}
+	if c.KnownHosts != "" {
+		known, err := OpenKnownHosts(c.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKnownHosts(known))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
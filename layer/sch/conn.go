@@ -0,0 +1,72 @@
+package sch
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/kisom/go-schannel/schannel"
+
+	"github.com/crackcomm/onion/internal/async"
+)
+
+var (
+	errRead  = errors.New("sch: read error")
+	errWrite = errors.New("sch: write error")
+)
+
+// connection - Connection wrapped with a schannel.
+type connection struct {
+	*async.Conn
+	peer *[32]byte
+}
+
+func newConnection(conn net.Conn, sch *schannel.SChannel, peer *[32]byte) *connection {
+	return &connection{
+		Conn: async.NewConn(conn, &stream{sch}),
+		peer: peer,
+	}
+}
+
+// PeerKey - Returns peer public key verified in the handshake.
+func (conn *connection) PeerKey() *[32]byte {
+	return conn.peer
+}
+
+// stream - Schannel message stream.
+type stream struct {
+	sch *schannel.SChannel
+}
+
+// Receive - Receives a message, returns io.EOF on shutdown message.
+func (s *stream) Receive() ([]byte, error) {
+	msg, ok := s.sch.Receive()
+	if !ok {
+		return nil, errRead
+	}
+	if msg.Type == schannel.ShutdownType {
+		return nil, io.EOF
+	}
+	return msg.Contents, nil
+}
+
+// Send - Sends a message.
+func (s *stream) Send(b []byte) error {
+	if !s.sch.Send(b) {
+		return errWrite
+	}
+	return nil
+}
+
+// Shutdown - Sends a shutdown message.
+func (s *stream) Shutdown() error {
+	if !s.sch.Close() {
+		return errWrite
+	}
+	return nil
+}
+
+// Release - Zeroes the keys.
+func (s *stream) Release() {
+	s.sch.Zero()
+}
@@ -0,0 +1,167 @@
+package sch
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+const (
+	// PublicKeySize - Size of a Schannel public key.
+	PublicKeySize = ed25519.PublicKeySize
+
+	// PrivateKeySize - Size of a Schannel private key.
+	PrivateKeySize = ed25519.PrivateKeySize
+)
+
+const (
+	publicKeyType  = "SCHANNEL PUBLIC KEY"
+	privateKeyType = "SCHANNEL PRIVATE KEY"
+	checksumHeader = "Checksum"
+)
+
+// ErrChecksum - Key checksum does not match.
+var ErrChecksum = errors.New("sch: key checksum mismatch")
+
+// GenerateKey - Generates a new Schannel signing key pair.
+// Uses crypto/rand if rand is nil.
+func GenerateKey(rand io.Reader) (pub *[PublicKeySize]byte, priv *[PrivateKeySize]byte, err error) {
+	public, private, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return
+	}
+	pub, priv = new([PublicKeySize]byte), new([PrivateKeySize]byte)
+	copy(pub[:], public)
+	copy(priv[:], private)
+	return
+}
+
+// MarshalPublicKey - Encodes public key in an armored text format.
+//
+// Keys are PEM blocks of type "SCHANNEL PUBLIC KEY" or "SCHANNEL PRIVATE KEY"
+// with a "Checksum" header holding hex encoded first 4 bytes
+// of SHA-256 sum of the key:
+//
+//	-----BEGIN SCHANNEL PUBLIC KEY-----
+//	Checksum: 2dfd602a
+//
+//	AAcOFRwjKjE4P0ZNVFtiaXB3foWMk5qhqK+2vcTL0tk=
+//	-----END SCHANNEL PUBLIC KEY-----
+func MarshalPublicKey(key *[PublicKeySize]byte) []byte {
+	return marshalKey(publicKeyType, key[:])
+}
+
+// MarshalPrivateKey - Encodes private key in an armored text format.
+// See MarshalPublicKey for format description.
+func MarshalPrivateKey(key *[PrivateKeySize]byte) []byte {
+	return marshalKey(privateKeyType, key[:])
+}
+
+// ParsePublicKey - Decodes armored public key and verifies its checksum.
+// Raw 32 byte keys are accepted for compatibility.
+func ParsePublicKey(body []byte) (key *[PublicKeySize]byte, err error) {
+	b, err := parseKey(publicKeyType, PublicKeySize, body)
+	if err != nil {
+		return
+	}
+	key = new([PublicKeySize]byte)
+	copy(key[:], b)
+	return
+}
+
+// ParsePrivateKey - Decodes armored private key and verifies its checksum.
+// Raw 64 byte keys are accepted for compatibility.
+func ParsePrivateKey(body []byte) (key *[PrivateKeySize]byte, err error) {
+	b, err := parseKey(privateKeyType, PrivateKeySize, body)
+	if err != nil {
+		return
+	}
+	key = new([PrivateKeySize]byte)
+	copy(key[:], b)
+	return
+}
+
+// ReadPublicKeyFile - Reads public key from a file.
+func ReadPublicKeyFile(filename string) (*[PublicKeySize]byte, error) {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(body)
+}
+
+// ReadPrivateKeyFile - Reads private key from a file.
+func ReadPrivateKeyFile(filename string) (*[PrivateKeySize]byte, error) {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePrivateKey(body)
+}
+
+// WritePublicKeyFile - Writes armored public key to a file.
+func WritePublicKeyFile(filename string, key *[PublicKeySize]byte) error {
+	return ioutil.WriteFile(filename, MarshalPublicKey(key), 0644)
+}
+
+// WritePrivateKeyFile - Writes armored private key to a file
+// readable only by the owner.
+func WritePrivateKeyFile(filename string, key *[PrivateKeySize]byte) error {
+	return ioutil.WriteFile(filename, MarshalPrivateKey(key), 0600)
+}
+
+// WithKeyFiles - Reads public and private key files
+// and returns an option setting both keys.
+func WithKeyFiles(pubfilename, privfilename string) (Option, error) {
+	pub, err := ReadPublicKeyFile(pubfilename)
+	if err != nil {
+		return nil, err
+	}
+	priv, err := ReadPrivateKeyFile(privfilename)
+	if err != nil {
+		return nil, err
+	}
+	return func(layer *Layer) {
+		layer.pub = pub
+		layer.priv = priv
+	}, nil
+}
+
+func marshalKey(typ string, key []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    typ,
+		Headers: map[string]string{checksumHeader: checksum(key)},
+		Bytes:   key,
+	})
+}
+
+func parseKey(typ string, size int, body []byte) ([]byte, error) {
+	block, _ := pem.Decode(body)
+	if block == nil {
+		if len(body) == size && !bytes.HasPrefix(body, []byte("-----")) {
+			return body, nil
+		}
+		return nil, fmt.Errorf("sch: no %s found", typ)
+	}
+	if block.Type != typ {
+		return nil, fmt.Errorf("sch: unexpected key type %q", block.Type)
+	}
+	if len(block.Bytes) != size {
+		return nil, fmt.Errorf("sch: invalid key size %d", len(block.Bytes))
+	}
+	if sum, ok := block.Headers[checksumHeader]; !ok || sum != checksum(block.Bytes) {
+		return nil, ErrChecksum
+	}
+	return block.Bytes, nil
+}
+
+func checksum(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
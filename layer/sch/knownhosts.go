@@ -0,0 +1,119 @@
+package sch
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrKeyMismatch - Peer presented a key different from the one known for the host.
+var ErrKeyMismatch = errors.New("sch: peer key does not match known host key")
+
+// KnownHosts - Trust-on-first-use store of peer public keys.
+//
+// Hosts are identified by dialed address, it's used only for dialed
+// connections. Remote address of accepted connections is not an identity,
+// behind an onion service it's a local address with a random port.
+// It is backed by a known_hosts-style file with one host per line,
+// followed by a base64 encoded public key. Empty lines and lines
+// starting with "#" are ignored:
+//
+//	# host key
+//	example.onion:80 AAcOFRwjKjE4P0ZNVFtiaXB3foWMk5qhqK+2vcTL0tk=
+type KnownHosts struct {
+	filename string
+
+	mutex *sync.Mutex
+	keys  map[string]*[32]byte
+}
+
+// OpenKnownHosts - Reads known hosts file.
+// File is created on first trusted key if it doesn't exist.
+func OpenKnownHosts(filename string) (*KnownHosts, error) {
+	known := &KnownHosts{
+		filename: filename,
+		mutex:    new(sync.Mutex),
+		keys:     make(map[string]*[32]byte),
+	}
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return known, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("sch: %s:%d: invalid line", filename, n)
+		}
+		key, err := decodeKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("sch: %s:%d: %v", filename, n, err)
+		}
+		known.keys[fields[0]] = key
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return known, nil
+}
+
+// Lookup - Returns known key of a host or nil.
+func (known *KnownHosts) Lookup(host string) *[32]byte {
+	known.mutex.Lock()
+	defer known.mutex.Unlock()
+	return known.keys[host]
+}
+
+// Verify - Verifies host key. If the host is not known
+// the key is trusted and appended to the file.
+func (known *KnownHosts) Verify(host string, key *[32]byte) error {
+	known.mutex.Lock()
+	defer known.mutex.Unlock()
+
+	if k, ok := known.keys[host]; ok {
+		if subtle.ConstantTimeCompare(k[:], key[:]) != 1 {
+			return ErrKeyMismatch
+		}
+		return nil
+	}
+
+	f, err := os.OpenFile(known.filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintf(f, "%s %s\n", host, base64.StdEncoding.EncodeToString(key[:])); err != nil {
+		return err
+	}
+
+	k := new([32]byte)
+	copy(k[:], key[:])
+	known.keys[host] = k
+	return nil
+}
+
+func decodeKey(s string) (*[32]byte, error) {
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) != 32 {
+		return nil, fmt.Errorf("invalid key size %d", len(b))
+	}
+	key := new([32]byte)
+	copy(key[:], b)
+	return key, nil
+}
@@ -1,17 +1,26 @@
+// Package sch implements Schannel encryption layer.
 package sch
 
 import (
+	"crypto/subtle"
 	"errors"
+	"io"
 	"net"
-	"time"
 
 	"github.com/kisom/go-schannel/schannel"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
 )
 
 // Layer - Schannel Layer.
 type Layer struct {
-	pub  *[32]byte
-	priv *[64]byte
+	pub   *[32]byte
+	priv  *[64]byte
+	peers []*[32]byte
+	known *KnownHosts
+
+	params onion.Params
 }
 
 // NewLayer - Creates a new Schannel layer.
@@ -27,29 +36,73 @@ func NewLayer(opts ...Option) (layer *Layer) {
 func (layer *Layer) Name() string { return "sch" }
 
 // Listener - Wraps listener with a Schannel layer.
+// Handshakes of accepted connections run concurrently with a deadline.
 func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
-	return &listener{
-		Listener: l,
-		layer:    layer,
-	}, nil
+	return accept.NewListener(l, "sch", layer.accept), nil
 }
 
 // Conn - Wraps the connection with a secure channel that uses Schannel.
 func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
-	sch, ok := schannel.Dial(conn, layer.priv, layer.pub)
+	peer, err := layer.peerKey(conn, true)
+	if err != nil {
+		return nil, err
+	}
+	sch, ok := schannel.Dial(conn, layer.priv, peer)
 	if !ok {
 		return nil, errors.New("sch dial error")
 	}
-	return &connection{
-		Conn: conn,
-		sch:  sch,
-	}, nil
+	return newConnection(conn, sch, peer), nil
+}
+
+// peerKey - Exchanges public keys and returns verified peer key.
+// Schannel handshake then proves possession of the private key.
+//
+// Peers are trusted by peer keys. Dialed peers not trusted by peer keys
+// are verified against known hosts by dialed address (trust on first use),
+// accepted peers have to be trusted by peer keys. When no peer keys
+// nor known hosts are configured our public key is expected
+// on the other side (single network key).
+func (layer *Layer) peerKey(conn net.Conn, dialed bool) (*[32]byte, error) {
+	if layer.pub == nil {
+		return nil, errors.New("sch: public key is not set")
+	}
+	errc := make(chan error, 1)
+	go func() {
+		_, err := conn.Write(layer.pub[:])
+		errc <- err
+	}()
+	peer := new([32]byte)
+	_, err := io.ReadFull(conn, peer[:])
+	if werr := <-errc; err == nil {
+		err = werr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	peers := layer.peers
+	if len(peers) == 0 && layer.known == nil {
+		peers = []*[32]byte{layer.pub}
+	}
+	for _, key := range peers {
+		if subtle.ConstantTimeCompare(key[:], peer[:]) == 1 {
+			return peer, nil
+		}
+	}
+	if !dialed || layer.known == nil {
+		return nil, ErrUnauthorized
+	}
+	if err := layer.known.Verify(conn.RemoteAddr().String(), peer); err != nil {
+		return nil, err
+	}
+	return peer, nil
 }
 
 // Option - Schannel layer option.
 type Option func(*Layer)
 
 // WithPubKey - Sets Schannel public key.
+// If no peer keys nor known hosts are set it's also used to verify peers.
 func WithPubKey(key *[32]byte) Option {
 	return func(layer *Layer) {
 		layer.pub = key
@@ -63,57 +116,33 @@ func WithPrivKey(key *[64]byte) Option {
 	}
 }
 
-// listener - Schannel layer listener.
-type listener struct {
-	net.Listener
-	layer *Layer
-}
-
-// Accept - Accepts connection. Look at schannel.Listen.
-func (listener *listener) Accept() (conn net.Conn, err error) {
-	conn, err = listener.Listener.Accept()
-	if err != nil {
-		return
-	}
-	sch, ok := schannel.Listen(conn, listener.layer.priv, listener.layer.pub)
-	if !ok {
-		return nil, errors.New("Schannel error")
+// WithPeerKeys - Adds trusted peer public keys.
+func WithPeerKeys(keys ...*[32]byte) Option {
+	return func(layer *Layer) {
+		layer.peers = append(layer.peers, keys...)
 	}
-	return &connection{
-		Conn: conn,
-		sch:  sch,
-	}, nil
 }
 
-// connection - Connection wrapped with a schannel.
-type connection struct {
-	net.Conn
-	sch *schannel.SChannel
-}
-
-func (conn *connection) Read(b []byte) (n int, err error) {
-	msg, ok := conn.sch.Receive()
-	if !ok {
-		return 0, errors.New("read error")
+// WithKnownHosts - Sets trust-on-first-use store of peer keys.
+// Dialed peers not trusted by peer keys are verified against it.
+// It's not used for accepted peers, they have to be trusted by peer keys.
+func WithKnownHosts(known *KnownHosts) Option {
+	return func(layer *Layer) {
+		layer.known = known
 	}
-	return copy(b, msg.Contents), nil
 }
 
-func (conn *connection) Write(b []byte) (n int, err error) {
-	if ok := conn.sch.Send(b); !ok {
-		return 0, errors.New("write error")
+// accept - Performs Schannel handshake on accepted connection.
+func (layer *Layer) accept(conn net.Conn) (net.Conn, error) {
+	peer, err := layer.peerKey(conn, false)
+	if err != nil {
+		return nil, err
 	}
-	return len(b), nil
-}
-
-// IsDialer - Returns false. Schannel layer is not a Dialer.
-func (layer *Layer) IsDialer() bool {
-	return false
-}
-
-// Dial - Returns nil, nil. Not a dialer.
-func (layer *Layer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
-	return nil, nil
+	sch, ok := schannel.Listen(conn, layer.priv, peer)
+	if !ok {
+		return nil, errors.New("Schannel error")
+	}
+	return newConnection(conn, sch, peer), nil
 }
 
 // Close - Does nothing.
@@ -0,0 +1,117 @@
+package sch
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/crackcomm/onion/layertest"
+)
+
+func generateKey(t *testing.T) Option {
+	pub, priv, err := GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func(layer *Layer) {
+		layer.pub, layer.priv = pub, priv
+	}
+}
+
+func TestConn(t *testing.T) {
+	keys := generateKey(t)
+	layertest.TestConn(t, NewLayer(keys), NewLayer(keys))
+}
+
+// listen - Returns address of a listener wrapped with the layer.
+func listen(t *testing.T, layer *Layer) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := layer.Listener(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func dial(layer *Layer, addr string) error {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	c, err := layer.Conn(conn)
+	if err != nil {
+		return err
+	}
+	return c.Close()
+}
+
+func TestUnauthorized(t *testing.T) {
+	addr := listen(t, NewLayer(generateKey(t)))
+	if err := dial(NewLayer(generateKey(t)), addr); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("dial error = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestKnownHosts(t *testing.T) {
+	client := generateKey(t)
+	server := NewLayer(generateKey(t), WithPeerKeys(NewLayer(client).pub))
+	addr := listen(t, server)
+
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	known, err := OpenKnownHosts(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dial(NewLayer(client, WithKnownHosts(known)), addr); err != nil {
+		t.Fatal(err)
+	}
+	if key := known.Lookup(addr); key == nil || *key != *server.pub {
+		t.Fatalf("known key = %v, want %v", key, server.pub)
+	}
+
+	known, err = OpenKnownHosts(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key := known.Lookup(addr); key == nil || *key != *server.pub {
+		t.Fatalf("key read from file = %v, want %v", key, server.pub)
+	}
+}
+
+func TestKnownHostsMismatch(t *testing.T) {
+	client := generateKey(t)
+	other := NewLayer(generateKey(t))
+	server := NewLayer(generateKey(t), WithPeerKeys(NewLayer(client).pub))
+	addr := listen(t, server)
+
+	filename := filepath.Join(t.TempDir(), "known_hosts")
+	line := fmt.Sprintf("%s %s\n", addr, base64.StdEncoding.EncodeToString(other.pub[:]))
+	if err := ioutil.WriteFile(filename, []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+	known, err := OpenKnownHosts(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dial(NewLayer(client, WithKnownHosts(known)), addr); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("dial error = %v, want %v", err, ErrKeyMismatch)
+	}
+}
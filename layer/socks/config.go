@@ -0,0 +1,52 @@
+package socks
+
+import (
+	"fmt"
+
+	"github.com/crackcomm/onion"
+)
+
+func init() {
+	onion.Register("socks", FromParams, onion.LayerInfo{
+		Description: "Dials through a SOCKS5 or SOCKS4a proxy",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - SOCKS proxy layer parameters.
+type params struct {
+	Proxy    string  `yaml:"proxy" help:"proxy address (default: 127.0.0.1:1080)"`
+	Version  Version `yaml:"version" help:"protocol version: 5 or 4 (default: 5)"`
+	Username string  `yaml:"username" help:"username"`
+	Password string  `yaml:"password" help:"password"`
+}
+
+// FromParams - Creates a SOCKS proxy layer from parameters:
+// proxy, version (5 or 4), username and password.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.Proxy != "" {
+		opts = append(opts, WithProxy(c.Proxy))
+	}
+	switch c.Version {
+	case 0:
+	case SOCKS5, SOCKS4A:
+		opts = append(opts, WithVersion(c.Version))
+	default:
+		return nil, fmt.Errorf("socks: unsupported version %d", c.Version)
+	}
+	if c.Username != "" {
+		opts = append(opts, WithAuth(c.Username, c.Password))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
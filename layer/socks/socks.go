@@ -0,0 +1,174 @@
+// Package socks implements SOCKS proxy dialer layer.
+//
+// SOCKS5 supports username/password authentication, SOCKS4a sends
+// username as user ID. Host names are resolved by the proxy.
+package socks
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/proxy"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/proxyutil"
+)
+
+// Version - SOCKS protocol version.
+type Version int
+
+const (
+	// SOCKS5 - SOCKS version 5.
+	SOCKS5 Version = 5
+
+	// SOCKS4A - SOCKS version 4a.
+	SOCKS4A Version = 4
+)
+
+// ErrIPv6 - SOCKS4a can't connect to IPv6 address.
+var ErrIPv6 = errors.New("socks: IPv6 address not supported by SOCKS4a")
+
+// Layer - SOCKS proxy Layer.
+type Layer struct {
+	proxy   string
+	version Version
+	auth    *proxy.Auth
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new SOCKS proxy layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{proxy: "127.0.0.1:1080", version: SOCKS5}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// Name - Returns "socks".
+func (layer *Layer) Name() string { return "socks" }
+
+// Dial - Dials through a SOCKS proxy.
+func (layer *Layer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", layer.proxy, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	glog.V(2).Infof("[socks] proxy => %s => %s", layer.proxy, addr)
+	return layer.DialConn(conn, addr, timeout)
+}
+
+// ProxyAddr - Returns SOCKS proxy address.
+func (layer *Layer) ProxyAddr() (string, error) {
+	return layer.proxy, nil
+}
+
+// DialConn - Dials through a connection to a SOCKS proxy.
+func (layer *Layer) DialConn(conn net.Conn, addr string, timeout time.Duration) (c net.Conn, err error) {
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	if layer.version == SOCKS4A {
+		err = layer.connect4a(conn, addr)
+		c = conn
+	} else {
+		c, err = layer.connect5(conn, addr)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &proxyutil.Conn{Conn: c, Addr: addr}, nil
+}
+
+// connect5 - Requests a SOCKS5 connection.
+func (layer *Layer) connect5(conn net.Conn, addr string) (net.Conn, error) {
+	dialer, err := proxy.SOCKS5("tcp", layer.proxy, layer.auth, proxyutil.ConnDialer{Conn: conn})
+	if err != nil {
+		return nil, err
+	}
+	return dialer.Dial("tcp", addr)
+}
+
+// connect4a - Requests a SOCKS4a connection.
+// IPv4 addresses are sent as in SOCKS4.
+func (layer *Layer) connect4a(conn net.Conn, addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return fmt.Errorf("socks: invalid port %q", portStr)
+	}
+
+	req := []byte{4, 1, 0, 0}
+	binary.BigEndian.PutUint16(req[2:], uint16(port))
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		req = append(req, 0, 0, 0, 1)
+	case ip.To4() != nil:
+		req = append(req, ip.To4()...)
+	default:
+		return ErrIPv6
+	}
+	if layer.auth != nil {
+		req = append(req, layer.auth.User...)
+	}
+	req = append(req, 0)
+	if ip == nil {
+		req = append(append(req, host...), 0)
+	}
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+
+	var resp [8]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return err
+	}
+	if resp[1] != 90 {
+		return fmt.Errorf("socks: request rejected with code %d", resp[1])
+	}
+	return nil
+}
+
+// Option - SOCKS proxy layer option.
+type Option func(*Layer)
+
+// WithProxy - Sets proxy address (default: 127.0.0.1:1080).
+func WithProxy(proxy string) Option {
+	return func(layer *Layer) {
+		layer.proxy = proxy
+	}
+}
+
+// WithVersion - Sets SOCKS protocol version (default: SOCKS5).
+func WithVersion(version Version) Option {
+	return func(layer *Layer) {
+		layer.version = version
+	}
+}
+
+// WithAuth - Sets username and password.
+// SOCKS4a sends only username as user ID.
+func WithAuth(username, password string) Option {
+	return func(layer *Layer) {
+		layer.auth = &proxy.Auth{User: username, Password: password}
+	}
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
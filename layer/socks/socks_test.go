@@ -0,0 +1,171 @@
+package socks
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/onion"
+	netlayer "github.com/crackcomm/onion/layer/net"
+	"github.com/crackcomm/onion/socksserver"
+)
+
+// echo - Returns address of a server echoing data.
+func echo(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// listen - Returns address of a SOCKS5 server dialing directly.
+func listen(t *testing.T, opts ...socksserver.Option) string {
+	o, err := onion.New(netlayer.NewLayer(netlayer.WithDial()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go socksserver.NewServer(o, opts...).Serve(l)
+	return l.Addr().String()
+}
+
+func TestDial(t *testing.T) {
+	target := echo(t)
+	users := socksserver.WithUsers(map[string]string{"user": "pass"})
+	for _, test := range []struct {
+		name  string
+		layer *Layer
+	}{
+		{name: "no auth", layer: NewLayer(WithProxy(listen(t)))},
+		{name: "auth", layer: NewLayer(WithProxy(listen(t, users)), WithAuth("user", "pass"))},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			conn, err := test.layer.Dial(target, time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if addr := conn.RemoteAddr().String(); addr != target {
+				t.Fatalf("remote address = %s, want %s", addr, target)
+			}
+			if _, err := conn.Write([]byte("hello")); err != nil {
+				t.Fatal(err)
+			}
+			b := make([]byte, 5)
+			if _, err := io.ReadFull(conn, b); err != nil || string(b) != "hello" {
+				t.Fatalf("read %q, %v, want hello", b, err)
+			}
+		})
+	}
+}
+
+func TestDialRejected(t *testing.T) {
+	users := socksserver.WithUsers(map[string]string{"user": "pass"})
+	for _, test := range []struct {
+		name   string
+		layer  *Layer
+		target string
+	}{
+		{name: "no auth", layer: NewLayer(WithProxy(listen(t, users)))},
+		{name: "wrong password", layer: NewLayer(WithProxy(listen(t, users)), WithAuth("user", "wrong"))},
+		{name: "unreachable", layer: NewLayer(WithProxy(listen(t))), target: "127.0.0.1:1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			target := test.target
+			if target == "" {
+				target = echo(t)
+			}
+			if conn, err := test.layer.Dial(target, time.Second); err == nil {
+				conn.Close()
+				t.Fatal("dial through proxy succeeded")
+			}
+		})
+	}
+}
+
+func TestSOCKS4A(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		addr    string
+		user    string
+		request []byte
+		reply   byte
+		err     bool
+	}{
+		{
+			name:    "domain",
+			addr:    "example.com:80",
+			user:    "user",
+			request: []byte("\x04\x01\x00\x50\x00\x00\x00\x01user\x00example.com\x00"),
+			reply:   90,
+		},
+		{
+			name:    "ipv4",
+			addr:    "10.0.0.1:443",
+			request: []byte("\x04\x01\x01\xbb\x0a\x00\x00\x01\x00"),
+			reply:   90,
+		},
+		{
+			name:    "rejected",
+			addr:    "10.0.0.1:443",
+			request: []byte("\x04\x01\x01\xbb\x0a\x00\x00\x01\x00"),
+			reply:   91,
+			err:     true,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer server.Close()
+			go func() {
+				b := make([]byte, len(test.request))
+				if _, err := io.ReadFull(server, b); err != nil || !bytes.Equal(b, test.request) {
+					server.Close()
+					return
+				}
+				server.Write([]byte{0, test.reply, 0, 0, 0, 0, 0, 0})
+			}()
+
+			opts := []Option{WithVersion(SOCKS4A)}
+			if test.user != "" {
+				opts = append(opts, WithAuth(test.user, "ignored"))
+			}
+			conn, err := NewLayer(opts...).DialConn(client, test.addr, time.Second)
+			if (err != nil) != test.err {
+				t.Fatalf("DialConn error = %v, want error %t", err, test.err)
+			}
+			if err == nil {
+				conn.Close()
+			}
+		})
+	}
+}
+
+func TestSOCKS4AIPv6(t *testing.T) {
+	client, server := net.Pipe()
+	defer server.Close()
+	_, err := NewLayer(WithVersion(SOCKS4A)).DialConn(client, "[::1]:80", time.Second)
+	if !errors.Is(err, ErrIPv6) {
+		t.Fatalf("DialConn error = %v, want %v", err, ErrIPv6)
+	}
+}
@@ -0,0 +1,110 @@
+package tls
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/crackcomm/onion"
+)
+
+// ErrUnauthorized - Peer certificate fingerprint is not allowed.
+var ErrUnauthorized = errors.New("tls: peer certificate not allowed")
+
+// ErrNoConn - Connection is not wrapped with a TLS layer.
+var ErrNoConn = errors.New("tls: no tls connection")
+
+// Fingerprint - Returns SHA-256 fingerprint of a certificate.
+func Fingerprint(cert *x509.Certificate) [sha256.Size]byte {
+	return sha256.Sum256(cert.Raw)
+}
+
+// fingerprintPrefix - Prefix of formatted fingerprints.
+const fingerprintPrefix = "sha256:"
+
+// FormatFingerprint - Formats fingerprint as "sha256:" followed by hex.
+func FormatFingerprint(fp [sha256.Size]byte) string {
+	return fingerprintPrefix + hex.EncodeToString(fp[:])
+}
+
+// ParseFingerprint - Parses fingerprint formatted by FormatFingerprint.
+// Prefix and colons between bytes are optional.
+func ParseFingerprint(s string) (fp [sha256.Size]byte, err error) {
+	s = strings.Replace(strings.TrimPrefix(s, fingerprintPrefix), ":", "", -1)
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return fp, fmt.Errorf("tls: invalid fingerprint: %v", err)
+	}
+	if len(b) != sha256.Size {
+		return fp, fmt.Errorf("tls: invalid fingerprint size %d", len(b))
+	}
+	copy(fp[:], b)
+	return fp, nil
+}
+
+// WithPins - Accepts only peers whose leaf certificate has one of the fingerprints.
+// Fingerprints are checked during the handshake like AllowFingerprints checks
+// them after it. Certificate chains are not verified, so self-signed
+// certificates can be pinned. Listening side requires client certificates.
+func WithPins(fingerprints ...[sha256.Size]byte) Option {
+	return func(layer *Layer) {
+		layer.config.InsecureSkipVerify = true
+		layer.config.ClientAuth = tls.RequireAnyClientCert
+		layer.config.VerifyPeerCertificate = func(raw [][]byte, _ [][]*x509.Certificate) error {
+			if len(raw) == 0 {
+				return ErrUnauthorized
+			}
+			return allowFingerprint(fingerprints, sha256.Sum256(raw[0]))
+		}
+	}
+}
+
+// AllowFingerprints - Returns an authorizer that accepts peers whose
+// leaf certificate in the outermost TLS layer has one of the fingerprints.
+// It completes the TLS handshake if it was not done yet.
+func AllowFingerprints(fingerprints ...[sha256.Size]byte) onion.Authorizer {
+	return onion.AuthorizerFunc(func(conn net.Conn) error {
+		cert, err := PeerCertificate(conn)
+		if err != nil {
+			return err
+		}
+		return allowFingerprint(fingerprints, Fingerprint(cert))
+	})
+}
+
+// allowFingerprint - Returns ErrUnauthorized if fingerprint is not one of allowed.
+func allowFingerprint(fingerprints [][sha256.Size]byte, fp [sha256.Size]byte) error {
+	for _, allowed := range fingerprints {
+		if subtle.ConstantTimeCompare(allowed[:], fp[:]) == 1 {
+			return nil
+		}
+	}
+	return ErrUnauthorized
+}
+
+// PeerCertificate - Returns peer leaf certificate of the outermost
+// TLS connection in the onion. It completes the handshake if needed.
+func PeerCertificate(conn net.Conn) (*x509.Certificate, error) {
+	var tc *tls.Conn
+	onion.Walk(conn, func(c net.Conn) bool {
+		tc, _ = c.(*tls.Conn)
+		return tc == nil
+	})
+	if tc == nil {
+		return nil, ErrNoConn
+	}
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+	certs := tc.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, ErrUnauthorized
+	}
+	return certs[0], nil
+}
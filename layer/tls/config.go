@@ -0,0 +1,61 @@
+package tls
+
+import (
+	"crypto/sha256"
+
+	"github.com/crackcomm/onion"
+)
+
+func init() {
+	onion.Register("tls", FromParams, onion.LayerInfo{
+		Description: "Encrypts streams with TLS",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - TLS layer parameters.
+type params struct {
+	Cert     string        `yaml:"cert" help:"certificate file"`
+	Key      string        `yaml:"key" help:"private key file"`
+	Insecure bool          `yaml:"insecure" help:"skip certificate verification"`
+	Pin      onion.Strings `yaml:"pin" help:"pinned peer certificate fingerprint or list of them (sha256:hex)"`
+}
+
+// FromParams - Creates a TLS layer from parameters:
+// cert and key (certificate and key files), insecure
+// and pin (fingerprints of pinned peer certificates, see WithPins).
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.Cert != "" || c.Key != "" {
+		opt, err := LoadCertAndKeyFile(c.Cert, c.Key)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, opt)
+	}
+	if c.Insecure {
+		opts = append(opts, WithInsecure())
+	}
+	if len(c.Pin) > 0 {
+		pins := make([][sha256.Size]byte, len(c.Pin))
+		for i, s := range c.Pin {
+			fp, err := ParseFingerprint(s)
+			if err != nil {
+				return nil, err
+			}
+			pins[i] = fp
+		}
+		opts = append(opts, WithPins(pins...))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
@@ -6,12 +6,15 @@ import (
 	"crypto/x509"
 	"io/ioutil"
 	"net"
-	"time"
+
+	"github.com/crackcomm/onion"
 )
 
 // Layer - TLS Layer.
 type Layer struct {
 	config *tls.Config
+
+	params onion.Params
 }
 
 // NewLayer - Creates a new TLS layer.
@@ -60,15 +63,35 @@ func WithInsecure() Option {
 }
 
 // WithCertAndKey - Sets certificate and private key.
+// Panics if certificate or key can't be parsed.
 func WithCertAndKey(certbody, privbody []byte) Option {
-	certx509, err := x509.ParseCertificate(certbody)
+	opt, err := certAndKey(certbody, privbody)
 	if err != nil {
 		panic(err)
 	}
-	privkey, err := x509.ParsePKCS1PrivateKey(privbody)
+	return opt
+}
+
+// WithCertAndKeyFile - Reads certificate and key file and adds to layer tls config.
+// Panics if read error occurs, see LoadCertAndKeyFile.
+func WithCertAndKeyFile(certfilename, privfilename string) Option {
+	opt, err := LoadCertAndKeyFile(certfilename, privfilename)
 	if err != nil {
 		panic(err)
 	}
+	return opt
+}
+
+// certAndKey - Parses certificate and key and returns option adding them.
+func certAndKey(certbody, privbody []byte) (Option, error) {
+	certx509, err := x509.ParseCertificate(certbody)
+	if err != nil {
+		return nil, err
+	}
+	privkey, err := x509.ParsePKCS1PrivateKey(privbody)
+	if err != nil {
+		return nil, err
+	}
 	cert := tls.Certificate{
 		Certificate: [][]byte{certbody},
 		PrivateKey:  privkey,
@@ -76,31 +99,20 @@ func WithCertAndKey(certbody, privbody []byte) Option {
 	return func(layer *Layer) {
 		layer.config.Certificates = append(layer.config.Certificates, cert)
 		layer.config.ClientCAs.AddCert(certx509)
-	}
+	}, nil
 }
 
-// WithCertAndKeyFile - Reads certificate and key file and adds to layer tls config.
-// Panics if read error occurs.
-func WithCertAndKeyFile(certfilename, privfilename string) Option {
+// LoadCertAndKeyFile - Reads certificate and key files and returns option adding them.
+func LoadCertAndKeyFile(certfilename, privfilename string) (Option, error) {
 	certbody, err := ioutil.ReadFile(certfilename)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 	privbody, err := ioutil.ReadFile(privfilename)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	return WithCertAndKey(certbody, privbody)
-}
-
-// IsDialer - Returns false. TLS layer can't dial.
-func (layer *Layer) IsDialer() bool {
-	return false
-}
-
-// Dial - Returns nil, nil. Not a dialer.
-func (layer *Layer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
-	return nil, nil
+	return certAndKey(certbody, privbody)
 }
 
 // Close - Does nothing.
@@ -0,0 +1,252 @@
+package tls
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/layertest"
+)
+
+// generateCert - Returns option adding a generated certificate
+// and its fingerprint.
+func generateCert(t *testing.T) (Option, [sha256.Size]byte) {
+	cert, key, err := GenerateCert("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return WithCertAndKey(cert, key), Fingerprint(parsed)
+}
+
+// TestConn - Tests data passes both ways through wrapped connections.
+// It doesn't use layertest.TestConn, crypto/tls connections can't be
+// written to after a write deadline was hit which nettest expects.
+func TestConn(t *testing.T) {
+	cert, _ := generateCert(t)
+	c1, c2, stop, err := layertest.MakePipe(NewLayer(cert, WithInsecure()), NewLayer(cert))()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	c1.SetDeadline(time.Now().Add(10 * time.Second))
+	c2.SetDeadline(time.Now().Add(10 * time.Second))
+	go func() {
+		io.Copy(c2, c2)
+		c2.Close()
+	}()
+	msg := bytes.Repeat([]byte("hello"), 10000)
+	go c1.Write(msg)
+	b := make([]byte, len(msg))
+	if _, err := io.ReadFull(c1, b); err != nil || !bytes.Equal(b, msg) {
+		t.Fatalf("echo read error = %v, equal %t", err, bytes.Equal(b, msg))
+	}
+	if _, ok := c1.(*tls.Conn); !ok {
+		t.Fatalf("dialed connection %T is not a TLS connection", c1)
+	}
+}
+
+func TestAllowFingerprints(t *testing.T) {
+	cert, fingerprint := generateCert(t)
+	_, other := generateCert(t)
+	for _, test := range []struct {
+		name         string
+		fingerprints [][sha256.Size]byte
+		err          error
+	}{
+		{name: "allowed", fingerprints: [][sha256.Size]byte{other, fingerprint}},
+		{name: "not allowed", fingerprints: [][sha256.Size]byte{other}, err: ErrUnauthorized},
+		{name: "none", err: ErrUnauthorized},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c1, c2, stop, err := layertest.MakePipe(NewLayer(cert, WithInsecure()), NewLayer(cert))()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+			auth := AllowFingerprints(test.fingerprints...)
+			errc := make(chan error, 1)
+			go func() { errc <- auth.Authorize(c2) }()
+			if err := auth.Authorize(c1); !errors.Is(err, test.err) {
+				t.Errorf("dialer Authorize error = %v, want %v", err, test.err)
+			}
+			if err := <-errc; !errors.Is(err, test.err) {
+				t.Errorf("listener Authorize error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestPeerCertificate(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	if _, err := PeerCertificate(c1); !errors.Is(err, ErrNoConn) {
+		t.Fatalf("PeerCertificate error = %v, want %v", err, ErrNoConn)
+	}
+}
+
+func TestFromParams(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		params   map[string]interface{}
+		insecure bool
+		err      bool
+	}{
+		{name: "empty"},
+		{name: "insecure", params: map[string]interface{}{"insecure": true}, insecure: true},
+		{name: "missing files", params: map[string]interface{}{"cert": "/nonexistent.crt", "key": "/nonexistent.key"}, err: true},
+		{name: "pin", params: map[string]interface{}{"pin": "sha256:" + strings.Repeat("ab", sha256.Size)}, insecure: true},
+		{name: "pin list", params: map[string]interface{}{"pin": []interface{}{strings.Repeat("ab", sha256.Size), strings.Repeat("cd:", sha256.Size-1) + "cd"}}, insecure: true},
+		{name: "invalid pin", params: map[string]interface{}{"pin": "sha256:abc"}, err: true},
+		{name: "unknown", params: map[string]interface{}{"pins": "abc"}, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			layer, err := FromParams(test.params)
+			if (err != nil) != test.err {
+				t.Fatalf("FromParams error = %v, want error %t", err, test.err)
+			}
+			if err == nil && layer.(*Layer).config.InsecureSkipVerify != test.insecure {
+				t.Fatalf("insecure = %t, want %t", !test.insecure, test.insecure)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	_, fp := generateCert(t)
+	s := FormatFingerprint(fp)
+	if !strings.HasPrefix(s, "sha256:") || len(s) != len("sha256:")+2*sha256.Size {
+		t.Fatalf("formatted fingerprint %q", s)
+	}
+	for _, test := range []struct {
+		name string
+		s    string
+		err  bool
+	}{
+		{name: "formatted", s: s},
+		{name: "no prefix", s: strings.TrimPrefix(s, "sha256:")},
+		{name: "colons", s: colons(strings.TrimPrefix(s, "sha256:"))},
+		{name: "short", s: s[:len(s)-2], err: true},
+		{name: "hex", s: "sha256:" + strings.Repeat("zz", sha256.Size), err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := ParseFingerprint(test.s)
+			if (err != nil) != test.err {
+				t.Fatalf("ParseFingerprint error = %v, want error %t", err, test.err)
+			}
+			if err == nil && parsed != fp {
+				t.Fatalf("parsed %x, want %x", parsed, fp)
+			}
+		})
+	}
+}
+
+// colons - Separates hex bytes with colons.
+func colons(s string) string {
+	var parts []string
+	for i := 0; i < len(s); i += 2 {
+		parts = append(parts, s[i:i+2])
+	}
+	return strings.Join(parts, ":")
+}
+
+func TestPins(t *testing.T) {
+	cert, fingerprint := generateCert(t)
+	_, other := generateCert(t)
+	for _, test := range []struct {
+		name string
+		pins [][sha256.Size]byte
+		err  bool
+	}{
+		{name: "pinned", pins: [][sha256.Size]byte{other, fingerprint}},
+		{name: "not pinned", pins: [][sha256.Size]byte{other}, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			c1, c2, stop, err := layertest.MakePipe(NewLayer(cert, WithPins(test.pins...)), NewLayer(cert, WithPins(fingerprint)))()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+			c1.SetDeadline(time.Now().Add(10 * time.Second))
+			c2.SetDeadline(time.Now().Add(10 * time.Second))
+			go c2.(*tls.Conn).Handshake()
+			if err := c1.(*tls.Conn).Handshake(); (err != nil) != test.err {
+				t.Fatalf("handshake error = %v, want error %t", err, test.err)
+			}
+		})
+	}
+}
+
+func TestSpecPins(t *testing.T) {
+	_, fp1 := generateCert(t)
+	_, fp2 := generateCert(t)
+	for _, spec := range []string{
+		"tls(pin=" + FormatFingerprint(fp1) + ")",
+		"tls(pin=[" + FormatFingerprint(fp1) + "," + FormatFingerprint(fp2) + "])",
+	} {
+		config, err := onion.ParseSpec(spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		o, err := onion.FromConfig(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := onion.SpecOf(o); s != spec {
+			t.Errorf("SpecOf = %s, want %s", s, spec)
+		}
+		o.Close()
+	}
+}
+
+func TestLoadCertAndKeyFile(t *testing.T) {
+	cert, key, err := GenerateCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	write := func(name string, body []byte) string {
+		filename := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(filename, body, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return filename
+	}
+	certfile, keyfile := write("tls.crt", cert), write("tls.key", key)
+	garbage := write("garbage", []byte("garbage"))
+	for _, test := range []struct {
+		name      string
+		cert, key string
+		err       bool
+	}{
+		{name: "valid", cert: certfile, key: keyfile},
+		{name: "missing cert", cert: filepath.Join(dir, "missing.crt"), key: keyfile, err: true},
+		{name: "missing key", cert: certfile, key: filepath.Join(dir, "missing.key"), err: true},
+		{name: "invalid cert", cert: garbage, key: keyfile, err: true},
+		{name: "invalid key", cert: certfile, key: garbage, err: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			opt, err := LoadCertAndKeyFile(test.cert, test.key)
+			if (err != nil) != test.err {
+				t.Fatalf("LoadCertAndKeyFile error = %v, want error %t", err, test.err)
+			}
+			if err == nil && len(NewLayer(opt).config.Certificates) != 1 {
+				t.Fatal("certificate was not added")
+			}
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package tor
+
+import "github.com/crackcomm/onion"
+
+func init() {
+	onion.Register("tor", FromParams, onion.LayerInfo{
+		Description: "Dials through TOR and exposes listeners as onion services",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - Tor layer parameters.
+type params struct {
+	Bin     string `yaml:"bin" help:"tor binary"`
+	Proxy   string `yaml:"proxy" help:"tor proxy address (socks5)"`
+	Port    uint16 `yaml:"port" help:"onion service port"`
+	Key     string `yaml:"key" help:"onion service key file"`
+	Verbose bool   `yaml:"verbose" help:"verbose tor"`
+}
+
+// FromParams - Creates a tor layer from parameters:
+// bin, proxy, port, key (onion service key file) and verbose.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	opts := []Option{WithVerbose(c.Verbose)}
+	if c.Bin != "" {
+		opts = append(opts, WithBin(c.Bin))
+	}
+	if c.Proxy != "" {
+		opts = append(opts, WithProxy(c.Proxy))
+	}
+	if c.Port != 0 {
+		opts = append(opts, WithPort(c.Port))
+	}
+	if c.Key != "" {
+		key, err := ReadKeyFile(c.Key)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKey(key))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
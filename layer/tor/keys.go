@@ -0,0 +1,86 @@
+package tor
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/yawning/bulb"
+	"golang.org/x/crypto/sha3"
+)
+
+// KeyType - Key type of v3 onion services.
+const KeyType = "ED25519-V3"
+
+// onionVersion - Version byte of v3 onion addresses.
+const onionVersion = 3
+
+// GenerateKey - Generates v3 onion service key.
+// Returns the key in a format accepted by WithKey and onion service ID.
+// Uses crypto/rand if rand is nil.
+func GenerateKey(rand io.Reader) (key *bulb.OnionPrivateKey, id string, err error) {
+	pub, priv, err := ed25519.GenerateKey(rand)
+	if err != nil {
+		return
+	}
+	// tor expects expanded secret key
+	expanded := sha512.Sum512(priv.Seed())
+	expanded[0] &= 248
+	expanded[31] &= 127
+	expanded[31] |= 64
+	key = &bulb.OnionPrivateKey{
+		KeyType: KeyType,
+		Key:     base64.StdEncoding.EncodeToString(expanded[:]),
+	}
+	return key, OnionID(pub), nil
+}
+
+// OnionID - Returns v3 onion service ID of a public key
+// (address without ".onion" suffix).
+func OnionID(pub ed25519.PublicKey) string {
+	h := sha3.New256()
+	h.Write([]byte(".onion checksum"))
+	h.Write(pub)
+	h.Write([]byte{onionVersion})
+	checksum := h.Sum(nil)
+
+	var b bytes.Buffer
+	b.Write(pub)
+	b.Write(checksum[:2])
+	b.WriteByte(onionVersion)
+	return strings.ToLower(base32.StdEncoding.EncodeToString(b.Bytes()))
+}
+
+// MarshalKey - Encodes key as "type:base64 key" used by tor.
+func MarshalKey(key *bulb.OnionPrivateKey) []byte {
+	return []byte(key.KeyType + ":" + key.Key + "\n")
+}
+
+// ParseKey - Decodes key encoded by MarshalKey.
+func ParseKey(body []byte) (*bulb.OnionPrivateKey, error) {
+	parts := strings.SplitN(strings.TrimSpace(string(body)), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("tor: invalid key format")
+	}
+	return &bulb.OnionPrivateKey{KeyType: parts[0], Key: parts[1]}, nil
+}
+
+// ReadKeyFile - Reads onion service key file.
+func ReadKeyFile(filename string) (*bulb.OnionPrivateKey, error) {
+	body, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return ParseKey(body)
+}
+
+// WriteKeyFile - Writes onion service key file readable only by the owner.
+func WriteKeyFile(filename string, key *bulb.OnionPrivateKey) error {
+	return ioutil.WriteFile(filename, MarshalKey(key), 0600)
+}
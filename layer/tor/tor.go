@@ -15,6 +15,7 @@ import (
 	"golang.org/x/net/context"
 	"golang.org/x/net/proxy"
 
+	"github.com/crackcomm/onion"
 	"github.com/crackcomm/onion/proxyutil"
 	"github.com/crackcomm/torctl"
 )
@@ -28,6 +29,8 @@ type Layer struct {
 	mutex   *sync.Mutex
 	client  *torctl.Client
 	created bool // true if created by layer, and if true closed by the layer
+
+	params onion.Params
 }
 
 // NewLayer - Creates a new TOR layer.
@@ -72,7 +75,7 @@ func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
 		{port, strconv.Itoa(int(addr.Port))},
 	}
 
-	info, err := control.AddOnion(ports, nil, true)
+	info, err := control.AddOnion(ports, layer.o.key, true)
 	if err != nil {
 		l.Close()
 		return nil, err
@@ -89,24 +92,42 @@ func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
 func (layer *Layer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
 	proxyaddr, err := layer.getProxy()
 	if err != nil {
-		layer.mutex.Unlock()
 		return nil, err
 	}
 
-	socks, err := proxy.SOCKS5("tcp", proxyaddr, nil, &net.Dialer{
-		Timeout: timeout,
-	})
+	conn, err := net.DialTimeout("tcp", proxyaddr, timeout)
 	if err != nil {
 		return nil, err
 	}
 
 	glog.Infof("[tor] proxy => %s => %s", proxyaddr, addr)
-	conn, err := socks.Dial("tcp", addr)
+	return layer.DialConn(conn, addr, timeout)
+}
+
+// ProxyAddr - Returns TOR proxy address.
+func (layer *Layer) ProxyAddr() (string, error) {
+	return layer.getProxy()
+}
+
+// DialConn - Dials through a connection to a TOR proxy.
+func (layer *Layer) DialConn(conn net.Conn, addr string, timeout time.Duration) (net.Conn, error) {
+	socks, err := proxy.SOCKS5("tcp", conn.RemoteAddr().String(), nil, proxyutil.ConnDialer{Conn: conn})
 	if err != nil {
+		conn.Close()
 		return nil, err
 	}
 
-	return conn, nil
+	if timeout > 0 {
+		conn.SetDeadline(time.Now().Add(timeout))
+		defer conn.SetDeadline(time.Time{})
+	}
+	c, err := socks.Dial("tcp", addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &proxyutil.Conn{Conn: c, Addr: addr}, nil
 }
 
 func (layer *Layer) getProxy() (string, error) {
@@ -125,11 +146,6 @@ func (layer *Layer) getProxy() (string, error) {
 	return layer.o.proxy, nil
 }
 
-// Conn - Returns back the same connection. TOR can't wrap an existing connection.
-func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
-	return conn, nil
-}
-
 // Close - Closes a TOR
 func (layer *Layer) Close() error {
 	if !layer.created || layer.client == nil {
@@ -144,11 +160,6 @@ func (layer *Layer) Close() error {
 	return layer.client.Close()
 }
 
-// IsDialer - Returns true, You can Dial through a TOR proxy.
-func (layer *Layer) IsDialer() bool {
-	return true
-}
-
 func (layer *Layer) torControl() (*bulb.Conn, error) {
 	layer.mutex.Lock()
 	defer layer.mutex.Unlock()
@@ -0,0 +1,47 @@
+package ws
+
+import "github.com/crackcomm/onion"
+
+func init() {
+	onion.Register("ws", FromParams, onion.LayerInfo{
+		Description: "Tunnels streams over WebSocket",
+		Layer:       (*Layer)(nil),
+		Params:      onion.ParamsOf(params{}),
+	})
+}
+
+// params - WebSocket layer parameters.
+type params struct {
+	Path    string            `yaml:"path" help:"path of the endpoint (default: /)"`
+	Host    string            `yaml:"host" help:"Host header of upgrade requests"`
+	Origin  string            `yaml:"origin" help:"origin sent and required"`
+	Headers map[string]string `yaml:"headers" help:"headers of upgrade requests"`
+}
+
+// FromParams - Creates a WebSocket layer from parameters:
+// path, host, origin and headers.
+func FromParams(p onion.Params) (onion.Layer, error) {
+	var c params
+	if err := p.Decode(&c); err != nil {
+		return nil, err
+	}
+	var opts []Option
+	if c.Path != "" {
+		opts = append(opts, WithPath(c.Path))
+	}
+	if c.Host != "" {
+		opts = append(opts, WithHost(c.Host))
+	}
+	if c.Origin != "" {
+		opts = append(opts, WithOrigin(c.Origin))
+	}
+	for key, value := range c.Headers {
+		opts = append(opts, WithHeader(key, value))
+	}
+	layer := NewLayer(opts...)
+	layer.params = p
+	return layer, nil
+}
+
+// Params - Returns parameters the layer was created with.
+func (layer *Layer) Params() onion.Params { return layer.params }
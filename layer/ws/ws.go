@@ -0,0 +1,286 @@
+// Package ws implements WebSocket transport layer.
+//
+// Connection is upgraded to a WebSocket and data is sent in binary messages,
+// so onion can pass networks allowing only HTTP(S). Listener serves HTTP
+// on the wrapped listener and accepts WebSocket upgrades on the path.
+package ws
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/websocket"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/internal/accept"
+	"github.com/crackcomm/onion/internal/async"
+)
+
+// ErrOrigin - WebSocket origin is not allowed.
+var ErrOrigin = errors.New("ws: origin not allowed")
+
+// ReadHeaderTimeout - Time limit of reading upgrade request headers,
+// so clients which never finish the request don't hold the listener resources.
+var ReadHeaderTimeout = accept.Timeout
+
+// closeNormal - Status code of normal closure.
+const closeNormal = 1000
+
+// Layer - WebSocket Layer.
+type Layer struct {
+	path   string
+	host   string
+	origin string
+	header http.Header
+
+	params onion.Params
+}
+
+// NewLayer - Creates a new WebSocket layer.
+func NewLayer(opts ...Option) (layer *Layer) {
+	layer = &Layer{path: "/", header: make(http.Header)}
+	for _, opt := range opts {
+		opt(layer)
+	}
+	return
+}
+
+// Name - Returns "ws".
+func (layer *Layer) Name() string { return "ws" }
+
+// Listener - Serves HTTP on the listener and accepts WebSocket upgrades.
+func (layer *Layer) Listener(l net.Listener) (net.Listener, error) {
+	return newListener(l, layer), nil
+}
+
+// Conn - Upgrades the connection to a WebSocket.
+// Host defaults to remote address of the connection.
+func (layer *Layer) Conn(conn net.Conn) (net.Conn, error) {
+	host := layer.host
+	if host == "" {
+		host = conn.RemoteAddr().String()
+	}
+	location := &url.URL{Scheme: "ws", Host: host, Path: layer.path}
+	origin := layer.origin
+	if origin == "" {
+		origin = "http://" + host
+	}
+	config, err := websocket.NewConfig(location.String(), origin)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range layer.header {
+		config.Header[key] = values
+	}
+	ws, err := websocket.NewClient(config, conn)
+	if err != nil {
+		return nil, err
+	}
+	return newConnection(conn, ws), nil
+}
+
+// handshake - Checks origin of the upgrade request if origin is set.
+func (layer *Layer) handshake(config *websocket.Config, req *http.Request) (err error) {
+	config.Origin, err = websocket.Origin(config, req)
+	if err != nil {
+		return
+	}
+	if layer.origin != "" && (config.Origin == nil || config.Origin.String() != layer.origin) {
+		return ErrOrigin
+	}
+	return
+}
+
+// Option - WebSocket layer option.
+type Option func(*Layer)
+
+// WithPath - Sets path of the WebSocket endpoint (default: "/").
+func WithPath(path string) Option {
+	return func(layer *Layer) {
+		layer.path = path
+	}
+}
+
+// WithHost - Sets Host header of the upgrade request.
+func WithHost(host string) Option {
+	return func(layer *Layer) {
+		layer.host = host
+	}
+}
+
+// WithOrigin - Sets origin sent by the dialing side.
+// Listening side accepts only upgrades with the origin.
+func WithOrigin(origin string) Option {
+	return func(layer *Layer) {
+		layer.origin = origin
+	}
+}
+
+// WithHeader - Adds a header to the upgrade request.
+func WithHeader(key, value string) Option {
+	return func(layer *Layer) {
+		layer.header.Add(key, value)
+	}
+}
+
+// connKey - Context key of the accepted connection.
+type connKey struct{}
+
+// listener - WebSocket layer listener.
+type listener struct {
+	net.Listener
+	server *http.Server
+
+	conns  chan net.Conn
+	errs   chan error
+	once   *sync.Once
+	closed chan struct{}
+}
+
+func newListener(l net.Listener, layer *Layer) *listener {
+	ln := &listener{
+		Listener: l,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error, 1),
+		once:     new(sync.Once),
+		closed:   make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.Handle(layer.path, websocket.Server{
+		Handshake: layer.handshake,
+		Handler:   ln.handle,
+	})
+	ln.server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: ReadHeaderTimeout,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			return context.WithValue(ctx, connKey{}, conn)
+		},
+	}
+	go func() {
+		err := ln.server.Serve(&serveListener{l})
+		if errors.Is(err, http.ErrServerClosed) {
+			err = net.ErrClosed
+		}
+		ln.errs <- err
+	}()
+	return ln
+}
+
+// Accept - Accepts upgraded connection.
+func (ln *listener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ln.conns:
+		return conn, nil
+	case err := <-ln.errs:
+		ln.Close()
+		return nil, err
+	case <-ln.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close - Stops HTTP server. Accepted connections are not closed.
+func (ln *listener) Close() (err error) {
+	err = net.ErrClosed
+	ln.once.Do(func() {
+		close(ln.closed)
+		err = ln.server.Close()
+	})
+	return
+}
+
+// handle - Passes upgraded connection to Accept
+// and keeps the handler until it's closed.
+func (ln *listener) handle(ws *websocket.Conn) {
+	conn, ok := ws.Request().Context().Value(connKey{}).(net.Conn)
+	if !ok {
+		return
+	}
+	c := newConnection(conn, ws)
+	select {
+	case ln.conns <- c:
+		<-c.released
+	case <-ln.closed:
+		c.Close()
+	}
+}
+
+// serveListener - Listener skipping errors of the wrapped layers,
+// so failed handshake of one connection doesn't stop the HTTP server.
+type serveListener struct {
+	net.Listener
+}
+
+// Accept - Accepts next connection.
+func (l *serveListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err == nil || errors.Is(err, net.ErrClosed) {
+			return conn, err
+		}
+		glog.Warningf("[ws] accept error: %v", err)
+	}
+}
+
+// connection - WebSocket connection.
+type connection struct {
+	*async.Conn
+	released chan struct{}
+}
+
+func newConnection(conn net.Conn, ws *websocket.Conn) *connection {
+	ws.PayloadType = websocket.BinaryFrame
+	s := &stream{
+		ws:       ws,
+		buf:      make([]byte, 32*1024),
+		released: make(chan struct{}),
+	}
+	return &connection{
+		Conn:     async.NewConn(conn, s),
+		released: s.released,
+	}
+}
+
+// stream - WebSocket message stream.
+type stream struct {
+	ws       *websocket.Conn
+	buf      []byte
+	released chan struct{}
+}
+
+// Receive - Returns data of received messages.
+// Returns io.EOF on close message.
+func (s *stream) Receive() ([]byte, error) {
+	n, err := s.ws.Read(s.buf)
+	if n > 0 {
+		return append([]byte(nil), s.buf[:n]...), nil
+	}
+	return nil, err
+}
+
+// Send - Sends data in a binary message.
+func (s *stream) Send(b []byte) error {
+	_, err := s.ws.Write(b)
+	return err
+}
+
+// Shutdown - Sends a close message.
+func (s *stream) Shutdown() error {
+	return s.ws.WriteClose(closeNormal)
+}
+
+// Release - Releases the listener handler.
+func (s *stream) Release() {
+	close(s.released)
+}
+
+// Close - Does nothing.
+func (layer *Layer) Close() error {
+	return nil
+}
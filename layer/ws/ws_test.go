@@ -0,0 +1,63 @@
+package ws
+
+import (
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/onion/layertest"
+)
+
+func TestConn(t *testing.T) {
+	layer := NewLayer(WithPath("/ws"), WithOrigin("https://example.com"), WithHeader("X-Test", "1"))
+	layertest.TestConn(t, layer, layer)
+}
+
+func TestRejected(t *testing.T) {
+	listener := NewLayer(WithPath("/ws"), WithOrigin("https://example.com"))
+	for _, test := range []struct {
+		name   string
+		dialer *Layer
+	}{
+		{name: "origin", dialer: NewLayer(WithPath("/ws"), WithOrigin("https://example.org"))},
+		{name: "default origin", dialer: NewLayer(WithPath("/ws"))},
+		{name: "path", dialer: NewLayer(WithPath("/"), WithOrigin("https://example.com"))},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, stop, err := layertest.MakePipe(test.dialer, listener)()
+			if err == nil {
+				stop()
+				t.Fatal("upgrade was accepted")
+			}
+		})
+	}
+}
+
+func TestReadHeaderTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { ReadHeaderTimeout = timeout }(ReadHeaderTimeout)
+	ReadHeaderTimeout = 100 * time.Millisecond
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := NewLayer().Listener(ln)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: example.com\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Fatalf("unfinished upgrade request was not closed: %v", err)
+	}
+}
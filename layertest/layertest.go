@@ -0,0 +1,73 @@
+// Package layertest implements conformance tests for onion layers.
+//
+// It's meant to be used in layer tests:
+//
+//	func TestConn(t *testing.T) {
+//		layertest.TestConn(t, sch.NewLayer(keys), sch.NewLayer(keys))
+//	}
+package layertest
+
+import (
+	"net"
+	"testing"
+
+	"golang.org/x/net/nettest"
+
+	"github.com/crackcomm/onion"
+)
+
+// TestConn - Tests that connections wrapped by layers satisfy net.Conn
+// interface using nettest.TestConn. Dialing side is wrapped with dialer
+// layer Conn and listening side with listener layer Listener.
+func TestConn(t *testing.T, dialer onion.Wrapper, listener onion.ListenerWrapper) {
+	nettest.TestConn(t, MakePipe(dialer, listener))
+}
+
+// MakePipe - Returns function creating pairs of connections wrapped with layers
+// on top of a local TCP connection.
+func MakePipe(dialer onion.Wrapper, listener onion.ListenerWrapper) nettest.MakePipe {
+	return func() (c1, c2 net.Conn, stop func(), err error) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return
+		}
+		l, err := listener.Listener(ln)
+		if err != nil {
+			ln.Close()
+			return
+		}
+		defer l.Close()
+
+		type accepted struct {
+			conn net.Conn
+			err  error
+		}
+		acceptc := make(chan accepted, 1)
+		go func() {
+			conn, err := l.Accept()
+			acceptc <- accepted{conn: conn, err: err}
+		}()
+
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return
+		}
+		c1, err = dialer.Conn(conn)
+		if err != nil {
+			conn.Close()
+			return
+		}
+
+		a := <-acceptc
+		if a.err != nil {
+			c1.Close()
+			return nil, nil, nil, a.err
+		}
+		c2 = a.conn
+		stop = func() {
+			c1.Close()
+			c2.Close()
+		}
+		return
+	}
+}
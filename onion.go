@@ -2,13 +2,13 @@
 //
 // Example onion could look like this:
 //
-// 	onion := New(
-// 		NetLayer(),
-// 		TorLayer(),
-// 		TLSLayer(),
-// 		NaClLayer(),
-// 		JWTLayer(keyLookupFunc),
-// 		NaClLayer(),
+// 	onion, err := New(
+// 		net.NewLayer(),
+// 		tor.NewLayer(),
+// 		tls.NewLayer(),
+// 		nacl.NewLayer(nacl.WithKeys(pub, priv)),
+// 		jwt.NewLayer(jwt.WithKeyLookup(keyLookupFunc)),
+// 		nacl.NewLayer(nacl.WithKeys(pub, priv)),
 // 	)
 //
 package onion
@@ -35,11 +35,19 @@ type Onion interface {
 
 	// Close - Closes all layers of the onion.
 	Close() error
+
+	// Describe - Returns dial and listen paths of the onion.
+	Describe() *Description
 }
 
 // New - Creates a new onion from given layers.
-func New(layers ...Layer) Onion {
-	return &onion{layers: layers}
+// Returns an error if layers are in impossible order,
+// for example when a wrapper precedes a dialer.
+func New(layers ...Layer) (Onion, error) {
+	if err := validate(layers); err != nil {
+		return nil, err
+	}
+	return &onion{layers: layers}, nil
 }
 
 // HTTP - Returns http Client that dials through an onion.
@@ -63,45 +71,101 @@ func (on *onion) Dial(network, addr string) (conn net.Conn, err error) {
 }
 
 // Connect - Connect for net.Dialer.
+//
+// First dialer layer dials the target. When it's followed by chain dialer
+// layers it dials proxy of the next one instead, which in turn dials
+// through the connection to proxy of the next one or to the target.
+// Connection is then wrapped by wrapper layers,
+// each handshake has to finish within the timeout.
 func (on *onion) Connect(addr string, timeout time.Duration) (conn net.Conn, err error) {
-	for _, layer := range on.layers {
-		if conn == nil && layer.IsDialer() {
+	for index, layer := range on.layers {
+		if conn == nil {
+			dialer, ok := layer.(Dialer)
+			if !ok {
+				continue
+			}
+			target, err := on.hopAddr(index, addr)
+			if err != nil {
+				return nil, err
+			}
+			if on.verbose {
+				glog.Infof("[%s] dial => %s", layer.Name(), target)
+			}
+			if conn, err = dialer.Dial(target, timeout); err != nil {
+				return nil, err
+			}
+		} else if chain, ok := layer.(ChainDialer); ok {
+			target, err := on.hopAddr(index, addr)
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
 			if on.verbose {
-				glog.Infof("[%s] dial => %s", layer.Name(), addr)
+				glog.Infof("[%s] dial through => %s", layer.Name(), target)
 			}
-			if c, err := layer.Dial(addr, timeout); err == nil {
-				conn = c
-			} else {
+			conn, err = chain.DialConn(conn, target, timeout)
+			if err != nil {
 				return nil, err
 			}
-		} else {
+		} else if wrapper, ok := layer.(Wrapper); ok {
 			if on.verbose {
 				glog.Infof("[%s] conn => %s", layer.Name(), addr)
 			}
-			conn, err = layer.Conn(conn)
+			if timeout > 0 {
+				conn.SetDeadline(time.Now().Add(timeout))
+			}
+			c, err := wrapper.Conn(conn)
 			if err != nil {
+				conn.Close()
 				return nil, err
 			}
+			conn.SetDeadline(time.Time{})
+			conn = c
 		}
 	}
+	if conn == nil {
+		return nil, ErrNoDialer
+	}
 	return
 }
 
+// hopAddr - Returns address dialed by dialer layer at index.
+// It's proxy address of the next chain dialer layer or the target.
+func (on *onion) hopAddr(index int, addr string) (string, error) {
+	for _, layer := range on.layers[index+1:] {
+		if chain, ok := layer.(ChainDialer); ok {
+			return chain.ProxyAddr()
+		}
+	}
+	return addr, nil
+}
+
 // Listener - Wraps a listener with an onion.
+// Listener source layer creates it if input listener is nil.
 func (on *onion) Listener(in net.Listener) (l net.Listener, err error) {
 	l = in
 	for _, layer := range on.layers {
-		if on.verbose {
-			if l == nil {
+		if source, ok := layer.(ListenerSource); ok && l == nil {
+			if on.verbose {
 				glog.Infof("[%s] listen init", layer.Name())
-			} else {
+			}
+			if l, err = source.Listen(); err != nil {
+				return nil, err
+			}
+		} else if wrapper, ok := layer.(ListenerWrapper); ok {
+			if l == nil {
+				return nil, ErrNoListener
+			}
+			if on.verbose {
 				glog.Infof("[%s] listen => %s", layer.Name(), l.Addr())
 			}
+			if l, err = wrapper.Listener(l); err != nil {
+				return nil, err
+			}
 		}
-		l, err = layer.Listener(l)
-		if err != nil {
-			return
-		}
+	}
+	if l == nil {
+		return nil, ErrNoListener
 	}
 	return
 }
@@ -120,6 +184,12 @@ func (on *onion) Close() (err error) {
 	return
 }
 
+// Describe - Returns dial and listen paths of the onion
+// without dialing or listening.
+func (on *onion) Describe() *Description {
+	return describe(on.layers)
+}
+
 // SetVerbose - When verbose is set to true it logs some info.
 func (on *onion) SetVerbose(v bool) {
 	on.verbose = v
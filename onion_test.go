@@ -0,0 +1,253 @@
+package onion
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testLayer - Layer without roles.
+type testLayer struct {
+	name   string
+	params Params
+	closed bool
+}
+
+func (layer *testLayer) Name() string { return layer.name }
+
+func (layer *testLayer) Params() Params { return layer.params }
+
+func (layer *testLayer) Close() error {
+	layer.closed = true
+	return nil
+}
+
+// testDialer - Dialer returning one side of a pipe.
+// Other sides are kept in peers.
+type testDialer struct {
+	testLayer
+	dialed []string
+	peers  []net.Conn
+}
+
+func newDialer(name string) *testDialer {
+	return &testDialer{testLayer: testLayer{name: name}}
+}
+
+func (layer *testDialer) Dial(addr string, timeout time.Duration) (net.Conn, error) {
+	layer.dialed = append(layer.dialed, addr)
+	conn, peer := net.Pipe()
+	layer.peers = append(layer.peers, peer)
+	return conn, nil
+}
+
+// testChainDialer - Chain dialer passing the connection through.
+type testChainDialer struct {
+	testDialer
+	proxy string
+}
+
+func newChainDialer(name, proxy string) *testChainDialer {
+	return &testChainDialer{testDialer: testDialer{testLayer: testLayer{name: name}}, proxy: proxy}
+}
+
+func (layer *testChainDialer) ProxyAddr() (string, error) { return layer.proxy, nil }
+
+func (layer *testChainDialer) DialConn(conn net.Conn, addr string, timeout time.Duration) (net.Conn, error) {
+	layer.dialed = append(layer.dialed, addr)
+	return conn, nil
+}
+
+// testConn - Connection wrapped by a test layer.
+type testConn struct {
+	net.Conn
+	layer string
+}
+
+func (conn *testConn) NetConn() net.Conn { return conn.Conn }
+
+// testWrapper - Wrapper failing with err if set.
+type testWrapper struct {
+	testLayer
+	err error
+}
+
+func newWrapper(name string) *testWrapper {
+	return &testWrapper{testLayer: testLayer{name: name}}
+}
+
+func (layer *testWrapper) Conn(conn net.Conn) (net.Conn, error) {
+	if layer.err != nil {
+		return nil, layer.err
+	}
+	return &testConn{Conn: conn, layer: layer.name}, nil
+}
+
+// testSource - Listener source listening on a local TCP port.
+type testSource struct {
+	testLayer
+}
+
+func newSource(name string) *testSource {
+	return &testSource{testLayer: testLayer{name: name}}
+}
+
+func (layer *testSource) Listen() (net.Listener, error) {
+	return net.Listen("tcp", "127.0.0.1:0")
+}
+
+// testListener - Listener wrapped by a test layer.
+type testListener struct {
+	net.Listener
+	layer string
+}
+
+// testListenerWrapper - Listener wrapper.
+type testListenerWrapper struct {
+	testLayer
+}
+
+func newListenerWrapper(name string) *testListenerWrapper {
+	return &testListenerWrapper{testLayer: testLayer{name: name}}
+}
+
+func (layer *testListenerWrapper) Listener(l net.Listener) (net.Listener, error) {
+	return &testListener{Listener: l, layer: layer.name}, nil
+}
+
+// testWrap - Layer wrapping both connections and listeners,
+// like encryption layers.
+type testWrap struct {
+	testWrapper
+}
+
+func newWrap(name string) *testWrap {
+	return &testWrap{testWrapper: testWrapper{testLayer: testLayer{name: name}}}
+}
+
+func (layer *testWrap) Listener(l net.Listener) (net.Listener, error) {
+	return &testListener{Listener: l, layer: layer.name}, nil
+}
+
+// layerNames - Returns names of test layers which wrapped the connection.
+func layerNames(conn net.Conn) (names []string) {
+	Walk(conn, func(c net.Conn) bool {
+		if tc, ok := c.(*testConn); ok {
+			names = append(names, tc.layer)
+		}
+		return true
+	})
+	return
+}
+
+func TestConnect(t *testing.T) {
+	dialer := newDialer("net")
+	proxy := newChainDialer("proxy", "proxy:1080")
+	o, err := New(dialer, proxy, newWrap("a"), newWrapper("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := o.Connect("target:80", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if want := []string{"proxy:1080"}; !reflect.DeepEqual(dialer.dialed, want) {
+		t.Errorf("net dialed %v, want %v", dialer.dialed, want)
+	}
+	if want := []string{"target:80"}; !reflect.DeepEqual(proxy.dialed, want) {
+		t.Errorf("proxy dialed %v, want %v", proxy.dialed, want)
+	}
+	if names, want := layerNames(conn), []string{"b", "a"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("connection wrapped by %v, want %v", names, want)
+	}
+}
+
+func TestConnectWrapperError(t *testing.T) {
+	dialer := newDialer("net")
+	wrapper := newWrapper("enc")
+	wrapper.err = errors.New("handshake failed")
+	o, err := New(dialer, wrapper)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Connect("target:80", time.Second); err != wrapper.err {
+		t.Fatalf("Connect error = %v, want %v", err, wrapper.err)
+	}
+	peer := dialer.peers[0]
+	peer.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := peer.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("dialed connection was not closed, read error = %v", err)
+	}
+}
+
+func TestConnectNoDialer(t *testing.T) {
+	o, err := New(newWrap("enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Connect("target:80", time.Second); err != ErrNoDialer {
+		t.Fatalf("Connect error = %v, want %v", err, ErrNoDialer)
+	}
+}
+
+func TestListener(t *testing.T) {
+	o, err := New(newSource("net"), newListenerWrapper("service"), newWrap("enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := o.Listener(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	tl, ok := l.(*testListener)
+	if !ok || tl.layer != "enc" {
+		t.Fatalf("listener %#v is not wrapped by enc", l)
+	}
+	if tl, ok := tl.Listener.(*testListener); !ok || tl.layer != "service" {
+		t.Fatalf("listener %#v is not wrapped by service", tl.Listener)
+	}
+}
+
+func TestListenerInput(t *testing.T) {
+	o, err := New(newWrap("enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Listener(nil); err != ErrNoListener {
+		t.Fatalf("Listener error = %v, want %v", err, ErrNoListener)
+	}
+	in, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	l, err := o.Listener(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tl, ok := l.(*testListener); !ok || tl.Listener != in {
+		t.Fatalf("input listener is not wrapped")
+	}
+}
+
+func TestClose(t *testing.T) {
+	dialer, wrap := newDialer("net"), newWrap("enc")
+	o, err := New(dialer, wrap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, layer := range []*testLayer{&dialer.testLayer, &wrap.testLayer} {
+		if !layer.closed {
+			t.Errorf("layer %s was not closed", layer.name)
+		}
+	}
+}
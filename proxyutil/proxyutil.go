@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"golang.org/x/net/proxy"
+
+	"github.com/crackcomm/onion"
 )
 
 // IPAddressURL - URL which returns requestee IP in response.
@@ -33,6 +35,53 @@ func Socks5HTTPClient(network, addr string) (*http.Client, error) {
 	}, nil
 }
 
+// ConnDialer - Dialer returning established connection.
+// It's used as forward dialer to run proxy handshake over the connection.
+type ConnDialer struct {
+	Conn net.Conn
+}
+
+// Dial - Returns the connection.
+func (dialer ConnDialer) Dial(network, addr string) (net.Conn, error) {
+	return dialer.Conn, nil
+}
+
+// Addr - Address dialed through a proxy.
+type Addr string
+
+// String - Returns dialed address.
+func (addr Addr) String() string {
+	return string(addr)
+}
+
+// Network - Always returns "tcp".
+func (addr Addr) Network() string {
+	return "tcp"
+}
+
+// Conn - Connection dialed through a proxy.
+type Conn struct {
+	net.Conn
+
+	// Addr - Address dialed through the proxy.
+	Addr string
+}
+
+// RemoteAddr - Returns dialed address instead of the proxy address.
+func (conn *Conn) RemoteAddr() net.Addr {
+	return Addr(conn.Addr)
+}
+
+// NetConn - Returns the proxy connection.
+func (conn *Conn) NetConn() net.Conn {
+	return conn.Conn
+}
+
+// CloseWrite - Closes write side of the proxy connection.
+func (conn *Conn) CloseWrite() error {
+	return onion.CloseWrite(conn.Conn)
+}
+
 // GetIPAddress - Gets client IP address.
 func GetIPAddress(client *http.Client) (addr string, err error) {
 	resp, err := client.Get(IPAddressURL)
@@ -0,0 +1,53 @@
+package proxyutil
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/crackcomm/onion"
+)
+
+func TestConn(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	c, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	conn := &Conn{Conn: c, Addr: "example.com:80"}
+	defer conn.Close()
+	if addr := conn.RemoteAddr(); addr.String() != "example.com:80" || addr.Network() != "tcp" {
+		t.Fatalf("remote address = %s %s, want tcp example.com:80", addr.Network(), addr)
+	}
+	var walked []net.Conn
+	onion.Walk(conn, func(c net.Conn) bool {
+		walked = append(walked, c)
+		return true
+	})
+	if len(walked) != 2 || walked[1] != c {
+		t.Fatalf("walked %v, want proxy connection after the dialed one", walked)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := peer.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read after CloseWrite = %v, want %v", err, io.EOF)
+	}
+
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+	if err := (&Conn{Conn: c1}).CloseWrite(); !errors.Is(err, onion.ErrCloseWrite) {
+		t.Fatalf("CloseWrite of pipe = %v, want %v", err, onion.ErrCloseWrite)
+	}
+}
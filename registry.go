@@ -0,0 +1,192 @@
+package onion
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Factory - Creates a layer from parameters.
+type Factory func(Params) (Layer, error)
+
+// LayerInfo - Metadata of a registered layer.
+type LayerInfo struct {
+	// Name - Name of the layer in configs and specs.
+	Name string
+
+	// Description - Short description of the layer.
+	Description string
+
+	// Layer - Value of the layer type, usually a nil pointer
+	// like (*tls.Layer)(nil). Roles are derived from interfaces it implements.
+	Layer Layer
+
+	// Params - Layer parameters, see ParamsOf.
+	Params []*ParamInfo
+
+	factory Factory
+}
+
+// Roles - Returns names of roles implemented by the layer type:
+// dialer, chain dialer, wrapper, listener and listener wrapper.
+func (info *LayerInfo) Roles() (roles []string) {
+	if _, ok := info.Layer.(Dialer); ok {
+		roles = append(roles, "dialer")
+	}
+	if _, ok := info.Layer.(ChainDialer); ok {
+		roles = append(roles, "chain dialer")
+	}
+	if _, ok := info.Layer.(Wrapper); ok {
+		roles = append(roles, "wrapper")
+	}
+	if _, ok := info.Layer.(ListenerSource); ok {
+		roles = append(roles, "listener")
+	}
+	if _, ok := info.Layer.(ListenerWrapper); ok {
+		roles = append(roles, "listener wrapper")
+	}
+	return
+}
+
+// Param - Returns parameter metadata by name.
+func (info *LayerInfo) Param(name string) (*ParamInfo, bool) {
+	for _, param := range info.Params {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return nil, false
+}
+
+// ParamInfo - Metadata of a layer parameter.
+type ParamInfo struct {
+	// Name - Parameter name.
+	Name string
+
+	// Type - Parameter type: string, int, bool, duration,
+	// list of a type (e.g. "[]int") or "map".
+	Type string
+
+	// Required - Layer can't be created without the parameter.
+	Required bool
+
+	// Description - Short description of the parameter.
+	Description string
+}
+
+// ParamsOf - Returns parameters schema of a struct decoded with Params.Decode.
+// Names are taken from yaml field tags, descriptions from help tags
+// and parameters tagged with `required:"true"` are required:
+//
+//	type params struct {
+//		Port int `yaml:"port" help:"listener port" required:"true"`
+//	}
+func ParamsOf(v interface{}) (params []*ParamInfo) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		params = append(params, &ParamInfo{
+			Name:        name,
+			Type:        paramType(field.Type),
+			Required:    field.Tag.Get("required") == "true",
+			Description: field.Tag.Get("help"),
+		})
+	}
+	return
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// paramType - Returns parameter type name of a Go type.
+func paramType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == durationType {
+		return "duration"
+	}
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "int"
+	case reflect.Float32, reflect.Float64:
+		return "float"
+	case reflect.Slice:
+		return "[]" + paramType(t.Elem())
+	case reflect.Map:
+		return "map"
+	default:
+		return t.Kind().String()
+	}
+}
+
+var (
+	registryMutex = new(sync.RWMutex)
+	registry      = make(map[string]*LayerInfo)
+)
+
+// Register - Registers layer factory under a name with metadata.
+// Layer packages register their factories on init,
+// so importing a package makes its layer available in configs.
+// Panics if the name is already registered or layer type is not set.
+func Register(name string, factory Factory, info LayerInfo) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, ok := registry[name]; ok {
+		panic("onion: layer " + name + " registered twice")
+	}
+	if info.Layer == nil {
+		panic("onion: layer " + name + " registered without layer type")
+	}
+	info.Name = name
+	info.factory = factory
+	registry[name] = &info
+}
+
+// Registered - Returns sorted names of registered layers.
+func Registered() (names []string) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// Lookup - Returns metadata of a registered layer.
+func Lookup(name string) (*LayerInfo, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+	info, ok := registry[name]
+	return info, ok
+}
+
+// NewLayer - Creates a registered layer.
+// Returns an error if a required parameter is missing.
+func NewLayer(name string, params Params) (Layer, error) {
+	info, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("onion: unknown layer %q", name)
+	}
+	for _, param := range info.Params {
+		if _, ok := params[param.Name]; param.Required && !ok {
+			return nil, fmt.Errorf("onion: layer %s: missing required parameter %q", name, param.Name)
+		}
+	}
+	layer, err := info.factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("onion: layer %s: %v", name, err)
+	}
+	return layer, nil
+}
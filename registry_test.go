@@ -0,0 +1,204 @@
+package onion
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testNet - Dialer and listener source, like net layer with dialing enabled.
+type testNet struct {
+	testDialer
+}
+
+func (layer *testNet) Listen() (net.Listener, error) {
+	return net.Listen("tcp", "127.0.0.1:0")
+}
+
+// testParams - Parameters of registered test layers.
+type testParams struct {
+	Secret  string            `yaml:"secret" help:"shared secret" required:"true"`
+	Port    int               `yaml:"port" help:"port"`
+	Peers   Strings           `yaml:"peers" help:"peer keys"`
+	Sizes   []int             `yaml:"sizes"`
+	Timeout time.Duration     `yaml:"timeout"`
+	Headers map[string]string `yaml:"headers"`
+	Ratio   *float64          `yaml:"ratio"`
+	Fail    bool              `yaml:"fail"`
+	Ignored string            `yaml:"-"`
+}
+
+// proxyParams - Parameters of registered test chain dialer.
+type proxyParams struct {
+	Proxy string `yaml:"proxy" required:"true"`
+}
+
+func init() {
+	Register("test-net", func(p Params) (Layer, error) {
+		if err := p.Decode(&struct{}{}); err != nil {
+			return nil, err
+		}
+		return &testNet{testDialer: testDialer{testLayer: testLayer{name: "test-net", params: p}}}, nil
+	}, LayerInfo{
+		Description: "Test dialer and listener source",
+		Layer:       (*testNet)(nil),
+	})
+	Register("test-proxy", func(p Params) (Layer, error) {
+		var c proxyParams
+		if err := p.Decode(&c); err != nil {
+			return nil, err
+		}
+		layer := newChainDialer("test-proxy", c.Proxy)
+		layer.params = p
+		return layer, nil
+	}, LayerInfo{
+		Description: "Test chain dialer",
+		Layer:       (*testChainDialer)(nil),
+		Params:      ParamsOf(proxyParams{}),
+	})
+	Register("test-enc", func(p Params) (Layer, error) {
+		var c testParams
+		if err := p.Decode(&c); err != nil {
+			return nil, err
+		}
+		if c.Fail {
+			return nil, errors.New("failed")
+		}
+		layer := newWrap("test-enc")
+		layer.params = p
+		return layer, nil
+	}, LayerInfo{
+		Description: "Test wrapper and listener wrapper",
+		Layer:       (*testWrap)(nil),
+		Params:      ParamsOf(testParams{}),
+	})
+}
+
+func TestRegistered(t *testing.T) {
+	names := Registered()
+	var test []string
+	for i, name := range names {
+		if i > 0 && names[i-1] >= name {
+			t.Fatalf("names %v are not sorted", names)
+		}
+		if strings.HasPrefix(name, "test-") {
+			test = append(test, name)
+		}
+	}
+	if want := []string{"test-enc", "test-net", "test-proxy", "test-source"}; !reflect.DeepEqual(test, want) {
+		t.Fatalf("registered test layers %v, want %v", test, want)
+	}
+}
+
+func TestRoles(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		roles []string
+	}{
+		{name: "test-net", roles: []string{"dialer", "listener"}},
+		{name: "test-proxy", roles: []string{"dialer", "chain dialer"}},
+		{name: "test-enc", roles: []string{"wrapper", "listener wrapper"}},
+	} {
+		info, ok := Lookup(test.name)
+		if !ok {
+			t.Fatalf("layer %s is not registered", test.name)
+		}
+		if info.Name != test.name {
+			t.Errorf("info name = %q, want %q", info.Name, test.name)
+		}
+		if roles := info.Roles(); !reflect.DeepEqual(roles, test.roles) {
+			t.Errorf("%s roles = %v, want %v", test.name, roles, test.roles)
+		}
+	}
+	if _, ok := Lookup("test-unknown"); ok {
+		t.Error("unknown layer was found")
+	}
+}
+
+func TestParamsOf(t *testing.T) {
+	want := []*ParamInfo{
+		{Name: "secret", Type: "string", Required: true, Description: "shared secret"},
+		{Name: "port", Type: "int", Description: "port"},
+		{Name: "peers", Type: "[]string", Description: "peer keys"},
+		{Name: "sizes", Type: "[]int"},
+		{Name: "timeout", Type: "duration"},
+		{Name: "headers", Type: "map"},
+		{Name: "ratio", Type: "float"},
+		{Name: "fail", Type: "bool"},
+	}
+	params := ParamsOf(&testParams{})
+	if len(params) != len(want) {
+		t.Fatalf("got %d params, want %d", len(params), len(want))
+	}
+	for i, param := range params {
+		if *param != *want[i] {
+			t.Errorf("param %d = %+v, want %+v", i, *param, *want[i])
+		}
+	}
+
+	info, _ := Lookup("test-enc")
+	if param, ok := info.Param("port"); !ok || param.Type != "int" {
+		t.Errorf("Param(port) = %+v, %t", param, ok)
+	}
+	if _, ok := info.Param("unknown"); ok {
+		t.Error("Param(unknown) was found")
+	}
+}
+
+func TestNewLayer(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		layer  string
+		params Params
+		err    string
+	}{
+		{name: "ok", layer: "test-enc", params: Params{"secret": "s", "peers": "key", "timeout": "1s"}},
+		{name: "list", layer: "test-enc", params: Params{"secret": "s", "peers": []interface{}{"a", "b"}}},
+		{name: "unknown layer", layer: "test-unknown", err: `onion: unknown layer "test-unknown"`},
+		{name: "missing required", layer: "test-enc", params: Params{"port": 1}, err: `onion: layer test-enc: missing required parameter "secret"`},
+		{name: "unknown param", layer: "test-enc", params: Params{"secret": "s", "key": 1}, err: "onion: layer test-enc: "},
+		{name: "wrong type", layer: "test-enc", params: Params{"secret": "s", "port": "port"}, err: "onion: layer test-enc: "},
+		{name: "factory error", layer: "test-enc", params: Params{"secret": "s", "fail": true}, err: "onion: layer test-enc: failed"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			layer, err := NewLayer(test.layer, test.params)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if c, ok := layer.(Configurable); !ok || !reflect.DeepEqual(c.Params(), test.params) {
+					t.Fatalf("layer params = %v, want %v", c.Params(), test.params)
+				}
+				return
+			}
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Fatalf("NewLayer error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		info LayerInfo
+	}{
+		{name: "test-enc", info: LayerInfo{Layer: (*testWrap)(nil)}},
+		{name: "test-no-type", info: LayerInfo{}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("Register did not panic")
+				}
+			}()
+			Register(test.name, nil, test.info)
+		})
+	}
+	if _, ok := Lookup("test-no-type"); ok {
+		t.Fatal("layer without type was registered")
+	}
+}
@@ -0,0 +1,341 @@
+// Package socksserver implements SOCKS5 server dialing through an onion.
+//
+// It lets applications which are not Go programs use an onion
+// as a SOCKS5 proxy. Only CONNECT command is supported.
+// SOCKS proxy dialer layer is implemented in layer/socks.
+package socksserver
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/golang/glog"
+
+	"github.com/crackcomm/onion"
+	"github.com/crackcomm/onion/forward"
+	"github.com/crackcomm/onion/internal/accept"
+)
+
+// replyTimeout - Time limit of writing reply to the client.
+const replyTimeout = 10 * time.Second
+
+const (
+	version     = 5
+	authVersion = 1
+
+	methodNone     = 0
+	methodPassword = 2
+	methodNoAccept = 0xff
+
+	cmdConnect = 1
+
+	atypIPv4   = 1
+	atypDomain = 3
+	atypIPv6   = 4
+)
+
+// Reply codes.
+const (
+	replySucceeded          = 0
+	replyGeneralFailure     = 1
+	replyNetworkUnreachable = 3
+	replyHostUnreachable    = 4
+	replyConnectionRefused  = 5
+	replyCommandUnsupported = 7
+	replyAddressUnsupported = 8
+)
+
+var (
+	// ErrVersion - Client uses unsupported SOCKS version.
+	ErrVersion = errors.New("socks: unsupported version")
+
+	// ErrMethod - Client offers no acceptable authentication method.
+	ErrMethod = errors.New("socks: no acceptable authentication method")
+
+	// ErrAuth - Client credentials were rejected.
+	ErrAuth = errors.New("socks: authentication failed")
+
+	// ErrCommand - Client requested unsupported command.
+	ErrCommand = errors.New("socks: command not supported")
+
+	// ErrAddressType - Client requested unsupported address type.
+	ErrAddressType = errors.New("socks: address type not supported")
+)
+
+// CredentialsFunc - Returns true if client credentials are valid.
+type CredentialsFunc func(username, password string) bool
+
+// Server - SOCKS5 server dialing through an onion.
+type Server struct {
+	onion       onion.Onion
+	credentials CredentialsFunc
+	timeout     time.Duration
+}
+
+// NewServer - Creates a new SOCKS5 server dialing through the onion.
+func NewServer(o onion.Onion, opts ...Option) (server *Server) {
+	server = &Server{onion: o, timeout: time.Minute}
+	for _, opt := range opts {
+		opt(server)
+	}
+	return
+}
+
+// Option - SOCKS5 server option.
+type Option func(*Server)
+
+// WithCredentials - Requires clients to authenticate with username and password.
+func WithCredentials(fn CredentialsFunc) Option {
+	return func(server *Server) {
+		server.credentials = fn
+	}
+}
+
+// WithUsers - Requires clients to authenticate as one of the users.
+// Map keys are usernames and values are passwords.
+// Passwords are compared in constant time.
+func WithUsers(users map[string]string) Option {
+	return WithCredentials(func(username, password string) bool {
+		expected, ok := users[username]
+		a, b := sha256.Sum256([]byte(expected)), sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare(a[:], b[:]) == 1 && ok
+	})
+}
+
+// WithTimeout - Sets timeout of connecting through the onion (default: 1 minute).
+func WithTimeout(timeout time.Duration) Option {
+	return func(server *Server) {
+		server.timeout = timeout
+	}
+}
+
+// ListenAndServe - Listens on TCP address and serves SOCKS5 clients.
+func (server *Server) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return server.Serve(l)
+}
+
+// Serve - Serves SOCKS5 clients accepted from listener.
+// It returns when listener is closed, other accept errors
+// are logged and retried with a backoff.
+func (server *Server) Serve(l net.Listener) error {
+	var backoff accept.Backoff
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if err := backoff.Retry("socks", err); err != nil {
+				return err
+			}
+			continue
+		}
+		backoff.Reset()
+		go func() {
+			if err := server.ServeConn(conn); err != nil {
+				glog.Warningf("[socks] %s: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// ServeConn - Serves a SOCKS5 client and closes the connection.
+// Client handshake has to finish within the timeout,
+// connecting through the onion has its own timeout.
+func (server *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(server.timeout))
+	if err := server.authenticate(conn); err != nil {
+		return err
+	}
+	addr, err := readRequest(conn)
+	if err != nil {
+		return err
+	}
+
+	glog.V(2).Infof("[socks] %s => %s", conn.RemoteAddr(), addr)
+	conn.SetDeadline(time.Time{})
+	target, err := server.onion.Connect(addr, server.timeout)
+	conn.SetWriteDeadline(time.Now().Add(replyTimeout))
+	if err != nil {
+		writeReply(conn, replyCode(err), nil)
+		return err
+	}
+	defer target.Close()
+
+	if err := writeReply(conn, replySucceeded, target.LocalAddr()); err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Time{})
+	forward.Pipe(conn, target)
+	return nil
+}
+
+// authenticate - Negotiates authentication method and authenticates client.
+func (server *Server) authenticate(conn net.Conn) error {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return err
+	}
+	if header[0] != version {
+		return ErrVersion
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+
+	method := byte(methodNone)
+	if server.credentials != nil {
+		method = methodPassword
+	}
+	if !contains(methods, method) {
+		conn.Write([]byte{version, methodNoAccept})
+		return ErrMethod
+	}
+	if _, err := conn.Write([]byte{version, method}); err != nil {
+		return err
+	}
+	if method == methodNone {
+		return nil
+	}
+
+	username, password, err := readCredentials(conn)
+	if err != nil {
+		return err
+	}
+	if !server.credentials(username, password) {
+		conn.Write([]byte{authVersion, 1})
+		return ErrAuth
+	}
+	_, err = conn.Write([]byte{authVersion, 0})
+	return err
+}
+
+// readCredentials - Reads username/password authentication request.
+func readCredentials(r io.Reader) (username, password string, err error) {
+	var header [2]byte
+	if _, err = io.ReadFull(r, header[:]); err != nil {
+		return
+	}
+	if header[0] != authVersion {
+		return "", "", ErrVersion
+	}
+	user := make([]byte, header[1])
+	if _, err = io.ReadFull(r, user); err != nil {
+		return
+	}
+	var size [1]byte
+	if _, err = io.ReadFull(r, size[:]); err != nil {
+		return
+	}
+	pass := make([]byte, size[0])
+	if _, err = io.ReadFull(r, pass); err != nil {
+		return
+	}
+	return string(user), string(pass), nil
+}
+
+// readRequest - Reads request and returns target address.
+// Replies with an error code to unsupported requests.
+func readRequest(conn net.Conn) (string, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", err
+	}
+	if header[0] != version {
+		return "", ErrVersion
+	}
+
+	var host string
+	switch header[3] {
+	case atypIPv4, atypIPv6:
+		ip := make(net.IP, net.IPv4len)
+		if header[3] == atypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", err
+		}
+		host = ip.String()
+	case atypDomain:
+		var size [1]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return "", err
+		}
+		domain := make([]byte, size[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return "", err
+		}
+		host = string(domain)
+	default:
+		writeReply(conn, replyAddressUnsupported, nil)
+		return "", ErrAddressType
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", err
+	}
+	if header[1] != cmdConnect {
+		writeReply(conn, replyCommandUnsupported, nil)
+		return "", fmt.Errorf("%w: %d", ErrCommand, header[1])
+	}
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// writeReply - Writes reply with bound address.
+// Zero IPv4 address is used when it's not a TCP address.
+func writeReply(w io.Writer, code byte, addr net.Addr) error {
+	ip, port := net.IPv4zero.To4(), 0
+	if tcp, ok := addr.(*net.TCPAddr); ok {
+		ip, port = tcp.IP, tcp.Port
+	}
+	reply := []byte{version, code, 0, atypIPv4}
+	if ip4 := ip.To4(); ip4 != nil {
+		reply = append(reply, ip4...)
+	} else {
+		reply[3] = atypIPv6
+		reply = append(reply, ip.To16()...)
+	}
+	reply = append(reply, byte(port>>8), byte(port))
+	_, err := w.Write(reply)
+	return err
+}
+
+// replyCode - Returns reply code for a connect error.
+func replyCode(err error) byte {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return replyConnectionRefused
+	case errors.Is(err, syscall.ENETUNREACH):
+		return replyNetworkUnreachable
+	case errors.Is(err, syscall.EHOSTUNREACH):
+		return replyHostUnreachable
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return replyHostUnreachable
+	default:
+		return replyGeneralFailure
+	}
+}
+
+func contains(methods []byte, method byte) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
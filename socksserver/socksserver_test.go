@@ -0,0 +1,229 @@
+package socksserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/crackcomm/onion"
+)
+
+// echoOnion - Onion connecting to an echo server after a delay.
+type echoOnion struct {
+	onion.Onion
+	delay time.Duration
+	err   error
+}
+
+// Connect - Returns a connection echoing data or the error.
+func (o *echoOnion) Connect(addr string, timeout time.Duration) (net.Conn, error) {
+	time.Sleep(o.delay)
+	if o.err != nil {
+		return nil, o.err
+	}
+	c1, c2 := net.Pipe()
+	go func() {
+		defer c2.Close()
+		io.Copy(c2, c2)
+	}()
+	return c1, nil
+}
+
+var (
+	greeting      = []byte{5, 1, methodNone}
+	greetingAuth  = []byte{5, 1, methodPassword}
+	request       = []byte("\x05\x01\x00\x03\x0bexample.com\x00\x50")
+	replyOK       = []byte{5, replySucceeded, 0, 1, 0, 0, 0, 0, 0, 0}
+	credentials   = []byte("\x01\x04user\x04pass")
+	wrongPassword = []byte("\x01\x04user\x05wrong")
+)
+
+// step - Bytes sent by the client and reply expected from the server.
+type step struct {
+	send, want []byte
+}
+
+func TestServeConn(t *testing.T) {
+	users := WithUsers(map[string]string{"user": "pass"})
+	refused := fmt.Errorf("dial: %w", syscall.ECONNREFUSED)
+	for _, test := range []struct {
+		name  string
+		onion *echoOnion
+		opts  []Option
+		steps []step
+		echo  bool
+		err   error
+	}{
+		{
+			name:  "connect",
+			onion: &echoOnion{},
+			steps: []step{{greeting, []byte{5, methodNone}}, {request, replyOK}},
+			echo:  true,
+		},
+		{
+			name:  "slow connect",
+			onion: &echoOnion{delay: 200 * time.Millisecond},
+			opts:  []Option{WithTimeout(100 * time.Millisecond)},
+			steps: []step{{greeting, []byte{5, methodNone}}, {request, replyOK}},
+			echo:  true,
+		},
+		{
+			name:  "password",
+			onion: &echoOnion{},
+			opts:  []Option{users},
+			steps: []step{{greetingAuth, []byte{5, methodPassword}}, {credentials, []byte{1, 0}}, {request, replyOK}},
+			echo:  true,
+		},
+		{
+			name:  "wrong password",
+			onion: &echoOnion{},
+			opts:  []Option{users},
+			steps: []step{{greetingAuth, []byte{5, methodPassword}}, {wrongPassword, []byte{1, 1}}},
+			err:   ErrAuth,
+		},
+		{
+			name:  "no acceptable method",
+			onion: &echoOnion{},
+			opts:  []Option{users},
+			steps: []step{{greeting, []byte{5, methodNoAccept}}},
+			err:   ErrMethod,
+		},
+		{
+			name:  "version",
+			onion: &echoOnion{},
+			steps: []step{{[]byte{4, 1}, nil}},
+			err:   ErrVersion,
+		},
+		{
+			name:  "bind command",
+			onion: &echoOnion{},
+			steps: []step{
+				{greeting, []byte{5, methodNone}},
+				{[]byte("\x05\x02\x00\x01\x7f\x00\x00\x01\x00\x50"), []byte{5, replyCommandUnsupported, 0, 1, 0, 0, 0, 0, 0, 0}},
+			},
+			err: ErrCommand,
+		},
+		{
+			name:  "address type",
+			onion: &echoOnion{},
+			steps: []step{
+				{greeting, []byte{5, methodNone}},
+				{[]byte{5, 1, 0, 2}, []byte{5, replyAddressUnsupported, 0, 1, 0, 0, 0, 0, 0, 0}},
+			},
+			err: ErrAddressType,
+		},
+		{
+			name:  "connection refused",
+			onion: &echoOnion{err: refused},
+			steps: []step{
+				{greeting, []byte{5, methodNone}},
+				{request, []byte{5, replyConnectionRefused, 0, 1, 0, 0, 0, 0, 0, 0}},
+			},
+			err: syscall.ECONNREFUSED,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client, conn := net.Pipe()
+			defer client.Close()
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+			errc := make(chan error, 1)
+			go func() {
+				errc <- NewServer(test.onion, test.opts...).ServeConn(conn)
+			}()
+
+			for _, step := range test.steps {
+				if _, err := client.Write(step.send); err != nil {
+					t.Fatal(err)
+				}
+				if step.want == nil {
+					continue
+				}
+				b := make([]byte, len(step.want))
+				if _, err := io.ReadFull(client, b); err != nil || !bytes.Equal(b, step.want) {
+					t.Fatalf("reply %v, %v, want %v", b, err, step.want)
+				}
+			}
+			if test.echo {
+				if _, err := client.Write([]byte("hello")); err != nil {
+					t.Fatal(err)
+				}
+				b := make([]byte, 5)
+				if _, err := io.ReadFull(client, b); err != nil || string(b) != "hello" {
+					t.Fatalf("read %q, %v, want hello", b, err)
+				}
+				client.Close()
+			}
+			if err := <-errc; !errors.Is(err, test.err) {
+				t.Fatalf("ServeConn error = %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestWithUsers(t *testing.T) {
+	var server Server
+	WithUsers(map[string]string{"user": "pass", "empty": ""})(&server)
+	for _, test := range []struct {
+		username, password string
+		ok                 bool
+	}{
+		{"user", "pass", true},
+		{"user", "wrong", false},
+		{"user", "", false},
+		{"empty", "", true},
+		{"unknown", "", false},
+		{"unknown", "pass", false},
+	} {
+		if ok := server.credentials(test.username, test.password); ok != test.ok {
+			t.Errorf("credentials(%q, %q) = %t, want %t", test.username, test.password, ok, test.ok)
+		}
+	}
+}
+
+// flakyListener - Listener failing first accepts.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, syscall.EMFILE
+	}
+	return l.Listener.Accept()
+}
+
+func TestServeAcceptErrors(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &flakyListener{Listener: ln, failures: 3}
+	done := make(chan error, 1)
+	go func() {
+		done <- NewServer(&echoOnion{}).Serve(l)
+	}()
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	client.Write(greeting)
+	b := make([]byte, 2)
+	if _, err := io.ReadFull(client, b); err != nil || !bytes.Equal(b, []byte{5, methodNone}) {
+		t.Fatalf("reply %v, %v, want %v", b, err, []byte{5, methodNone})
+	}
+
+	l.Close()
+	if err := <-done; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Serve error = %v, want %v", err, net.ErrClosed)
+	}
+}
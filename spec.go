@@ -0,0 +1,347 @@
+package onion
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrSpec - Onion spec string is malformed.
+var ErrSpec = errors.New("onion: invalid spec")
+
+// Configurable - Layer which returns parameters it was created with.
+// Layers created by registered factories implement it,
+// it's used to render onions back to specs and configs.
+type Configurable interface {
+	Layer
+
+	// Params - Returns layer parameters, nil if created with options.
+	Params() Params
+}
+
+// ParseSpec - Parses one-line onion spec into a configuration.
+//
+// Spec is a list of layers separated by "+", each layer
+// optionally followed by parameters in parentheses:
+//
+//	net+tor(port=80)+tls(pin=sha256:...)+sch(keys=/etc/k)
+//
+// Values are typed like YAML scalars, lists are written in brackets
+// (e.g. "pad(buckets=[128,512])") and values containing special
+// characters are double quoted.
+func ParseSpec(spec string) (*Config, error) {
+	p := &specParser{spec: strings.TrimSpace(spec)}
+	config := new(Config)
+	for {
+		lc, err := p.layer()
+		if err != nil {
+			return nil, err
+		}
+		config.Layers = append(config.Layers, lc)
+		if p.done() {
+			return config, nil
+		}
+		if err := p.expect('+'); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// FromSpec - Creates an onion from a spec.
+func FromSpec(spec string) (Onion, error) {
+	config, err := ParseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return FromConfig(config)
+}
+
+// Spec - Renders configuration as a one-line spec.
+func (config *Config) Spec() string {
+	layers := make([]string, len(config.Layers))
+	for i, lc := range config.Layers {
+		layers[i] = lc.spec()
+	}
+	return strings.Join(layers, "+")
+}
+
+// Layered - Onion wrapping another onion, like ones returned by
+// WithAuthorizer or mux.New. Layers returns layers of the wrapped onion.
+type Layered interface {
+	Layers() []Layer
+}
+
+// Layers - Returns layers of an onion created with New
+// or of an onion wrapped by a Layered onion.
+// Returns nil for other onion implementations.
+func Layers(o Onion) []Layer {
+	switch on := o.(type) {
+	case *onion:
+		return on.layers
+	case Layered:
+		return on.Layers()
+	default:
+		return nil
+	}
+}
+
+// ConfigOf - Returns configuration of an onion, see Layers.
+// Parameters are included for Configurable layers.
+func ConfigOf(o Onion) *Config {
+	config := new(Config)
+	for _, layer := range Layers(o) {
+		lc := &LayerConfig{Name: layer.Name()}
+		if c, ok := layer.(Configurable); ok {
+			lc.Params = c.Params()
+		}
+		config.Layers = append(config.Layers, lc)
+	}
+	return config
+}
+
+// SpecOf - Renders an onion as a one-line spec.
+// See ConfigOf.
+func SpecOf(o Onion) string {
+	return ConfigOf(o).Spec()
+}
+
+func (lc *LayerConfig) spec() string {
+	if len(lc.Params) == 0 {
+		return lc.Name
+	}
+	keys := make([]string, 0, len(lc.Params))
+	for key := range lc.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([]string, len(keys))
+	for i, key := range keys {
+		params[i] = key + "=" + specValue(lc.Params[key])
+	}
+	return lc.Name + "(" + strings.Join(params, ",") + ")"
+}
+
+// specValue - Formats parameter value so it's parsed back the same.
+func specValue(v interface{}) string {
+	switch v := v.(type) {
+	case []interface{}:
+		values := make([]string, len(v))
+		for i, e := range v {
+			values[i] = specValue(e)
+		}
+		return "[" + strings.Join(values, ",") + "]"
+	case []string:
+		values := make([]string, len(v))
+		for i, e := range v {
+			values[i] = specValue(e)
+		}
+		return "[" + strings.Join(values, ",") + "]"
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			m[key] = value
+		}
+		return specValue(m)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entries := make([]string, len(keys))
+		for i, key := range keys {
+			entries[i] = key + "=" + specValue(v[key])
+		}
+		return "{" + strings.Join(entries, ",") + "}"
+	case string:
+		if s := scalar(v); s == v && !strings.ContainsAny(v, specSpecial) {
+			return v
+		}
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// specSpecial - Characters which have to be quoted in values.
+const specSpecial = "+=,()[]{}\" \t\n"
+
+// scalar - Resolves value like an untagged YAML scalar.
+// Returns value as is if it's not a scalar.
+func scalar(value string) interface{} {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(value), &v); err != nil {
+		return value
+	}
+	switch v.(type) {
+	case string, int, float64, bool:
+		return v
+	default:
+		return value
+	}
+}
+
+// specParser - Spec string parser.
+type specParser struct {
+	spec string
+	pos  int
+}
+
+func (p *specParser) done() bool {
+	return p.pos >= len(p.spec)
+}
+
+func (p *specParser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.spec[p.pos]
+}
+
+func (p *specParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func (p *specParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at %d: %s", ErrSpec, p.pos, fmt.Sprintf(format, args...))
+}
+
+// token - Reads characters until one of the terminators.
+func (p *specParser) token(terminators string) string {
+	start := p.pos
+	for !p.done() && !strings.ContainsRune(terminators, rune(p.peek())) {
+		p.pos++
+	}
+	return strings.TrimSpace(p.spec[start:p.pos])
+}
+
+// layer - Parses layer name with optional parameters.
+func (p *specParser) layer() (*LayerConfig, error) {
+	lc := &LayerConfig{Name: p.token("+(")}
+	if lc.Name == "" {
+		return nil, p.errorf("expected layer name")
+	}
+	if p.peek() != '(' {
+		return lc, nil
+	}
+	p.pos++
+	lc.Params = make(Params)
+	for p.peek() != ')' {
+		key := p.token("=,)")
+		if key == "" {
+			return nil, p.errorf("expected parameter name")
+		}
+		if err := p.expect('='); err != nil {
+			return nil, err
+		}
+		if _, ok := lc.Params[key]; ok {
+			return nil, p.errorf("duplicate parameter %q", key)
+		}
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		lc.Params[key] = value
+		if err := p.next(')'); err != nil {
+			return nil, err
+		}
+	}
+	p.pos++
+	p.skipSpace()
+	return lc, nil
+}
+
+// value - Parses quoted, list or scalar value.
+func (p *specParser) value() (interface{}, error) {
+	p.skipSpace()
+	defer p.skipSpace()
+	switch p.peek() {
+	case '"':
+		return p.quoted()
+	case '[':
+		p.pos++
+		list := []interface{}{}
+		for p.peek() != ']' {
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+			if err := p.next(']'); err != nil {
+				return nil, err
+			}
+		}
+		p.pos++
+		return list, nil
+	case '{':
+		p.pos++
+		m := make(map[string]interface{})
+		for p.peek() != '}' {
+			key := p.token("=,}")
+			if key == "" {
+				return nil, p.errorf("expected key")
+			}
+			if err := p.expect('='); err != nil {
+				return nil, err
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+			if err := p.next('}'); err != nil {
+				return nil, err
+			}
+		}
+		p.pos++
+		return m, nil
+	default:
+		return scalar(p.token(",)]}")), nil
+	}
+}
+
+// next - Skips "," separator unless at the closing character.
+func (p *specParser) next(closing byte) error {
+	if p.peek() == ',' {
+		p.pos++
+		return nil
+	} else if p.peek() != closing {
+		return p.errorf("expected %q or %q", ',', closing)
+	}
+	return nil
+}
+
+func (p *specParser) skipSpace() {
+	for p.peek() == ' ' {
+		p.pos++
+	}
+}
+
+// quoted - Parses double quoted Go string.
+func (p *specParser) quoted() (string, error) {
+	start := p.pos
+	p.pos++
+	for !p.done() && p.peek() != '"' {
+		if p.peek() == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	if p.done() {
+		return "", p.errorf("unterminated string")
+	}
+	p.pos++
+	s, err := strconv.Unquote(p.spec[start:p.pos])
+	if err != nil {
+		return "", p.errorf("invalid string %s", p.spec[start:p.pos])
+	}
+	return s, nil
+}
@@ -0,0 +1,193 @@
+package onion
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestParseSpec(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		spec   string
+		layers []*LayerConfig
+	}{
+		{
+			name:   "layers",
+			spec:   "net+tor+sch",
+			layers: []*LayerConfig{{Name: "net"}, {Name: "tor"}, {Name: "sch"}},
+		},
+		{
+			name: "params",
+			spec: "net+tor(port=80,debug=true,ratio=0.5,key=/etc/k)",
+			layers: []*LayerConfig{
+				{Name: "net"},
+				{Name: "tor", Params: Params{"port": 80, "debug": true, "ratio": 0.5, "key": "/etc/k"}},
+			},
+		},
+		{
+			name:   "empty params",
+			spec:   "net()",
+			layers: []*LayerConfig{{Name: "net", Params: Params{}}},
+		},
+		{
+			name:   "quoted",
+			spec:   `psk(secret="a,b=(c)",port="80",line="\n")`,
+			layers: []*LayerConfig{{Name: "psk", Params: Params{"secret": "a,b=(c)", "port": "80", "line": "\n"}}},
+		},
+		{
+			name:   "list",
+			spec:   `pad(buckets=[128,512],peers=["a b",c],empty=[])`,
+			layers: []*LayerConfig{{Name: "pad", Params: Params{"buckets": []interface{}{128, 512}, "peers": []interface{}{"a b", "c"}, "empty": []interface{}{}}}},
+		},
+		{
+			name: "map",
+			spec: `ws(headers={Host=example.com,X-Key="a,b"},nested={list=[1]})`,
+			layers: []*LayerConfig{{Name: "ws", Params: Params{
+				"headers": map[string]interface{}{"Host": "example.com", "X-Key": "a,b"},
+				"nested":  map[string]interface{}{"list": []interface{}{1}},
+			}}},
+		},
+		{
+			name:   "spaces",
+			spec:   "  net + tor( port = 80 , peers = [ a , b ] ) + sch ",
+			layers: []*LayerConfig{{Name: "net"}, {Name: "tor", Params: Params{"port": 80, "peers": []interface{}{"a", "b"}}}, {Name: "sch"}},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			config, err := ParseSpec(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (&Config{Layers: test.layers}); !reflect.DeepEqual(config, want) {
+				t.Fatalf("parsed %#v, want %#v", config, want)
+			}
+		})
+	}
+}
+
+func TestParseSpecErrors(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		spec string
+	}{
+		{name: "empty", spec: ""},
+		{name: "separator", spec: "+"},
+		{name: "trailing separator", spec: "net+"},
+		{name: "unclosed params", spec: "net("},
+		{name: "missing value", spec: "net(port)"},
+		{name: "missing name", spec: "net(=80)"},
+		{name: "unterminated params", spec: "net(port=80"},
+		{name: "duplicate param", spec: "net(port=80,port=81)"},
+		{name: "unterminated string", spec: `psk(secret="abc)`},
+		{name: "invalid string", spec: `psk(secret="\q")`},
+		{name: "unterminated list", spec: "pad(buckets=[128,512)"},
+		{name: "missing map value", spec: "ws(headers={Host})"},
+		{name: "missing separator", spec: "net(port=80)tor"},
+		{name: "value after string", spec: `psk(secret="a"b)`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if config, err := ParseSpec(test.spec); !errors.Is(err, ErrSpec) {
+				t.Fatalf("ParseSpec(%q) = %#v, %v, want %v", test.spec, config, err, ErrSpec)
+			}
+		})
+	}
+}
+
+func TestConfigSpec(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		config *Config
+		spec   string
+	}{
+		{
+			name:   "layers",
+			config: &Config{Layers: []*LayerConfig{{Name: "net"}, {Name: "sch", Params: Params{}}}},
+			spec:   "net+sch",
+		},
+		{
+			name: "sorted params",
+			config: &Config{Layers: []*LayerConfig{
+				{Name: "tor", Params: Params{"port": 80, "debug": true}},
+			}},
+			spec: "tor(debug=true,port=80)",
+		},
+		{
+			name: "quoted",
+			config: &Config{Layers: []*LayerConfig{
+				{Name: "psk", Params: Params{"secret": "a b,c", "port": "80", "flag": "true", "empty": ""}},
+			}},
+			spec: `psk(empty=,flag="true",port="80",secret="a b,c")`,
+		},
+		{
+			name: "list and map",
+			config: &Config{Layers: []*LayerConfig{
+				{Name: "ws", Params: Params{
+					"peers":   []string{"a", "b c"},
+					"sizes":   []interface{}{128, 512},
+					"headers": map[string]string{"X-B": "2", "X-A": "1"},
+				}},
+			}},
+			spec: `ws(headers={X-A="1",X-B="2"},peers=[a,"b c"],sizes=[128,512])`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			spec := test.config.Spec()
+			if spec != test.spec {
+				t.Fatalf("spec = %s, want %s", spec, test.spec)
+			}
+			config, err := ParseSpec(spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again := config.Spec(); again != spec {
+				t.Fatalf("parsed spec renders as %s, want %s", again, spec)
+			}
+		})
+	}
+}
+
+// testLayered - Onion wrapping another onion.
+type testLayered struct {
+	Onion
+}
+
+func (on *testLayered) Layers() []Layer { return Layers(on.Onion) }
+
+func TestSpecOf(t *testing.T) {
+	const spec = "test-net+test-proxy(proxy=proxy:1080)+test-enc(peers=[a,b],secret=s)"
+	o, err := FromSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	if s := SpecOf(o); s != spec {
+		t.Fatalf("SpecOf = %s, want %s", s, spec)
+	}
+	auth := WithAuthorizer(o, AuthorizerFunc(func(net.Conn) error { return nil }))
+	if s := SpecOf(auth); s != spec {
+		t.Fatalf("SpecOf onion with authorizer = %s, want %s", s, spec)
+	}
+
+	layered := &testLayered{Onion: o}
+	if s := SpecOf(layered); s != spec {
+		t.Fatalf("SpecOf Layered onion = %s, want %s", s, spec)
+	}
+	if config := ConfigOf(struct{ Onion }{o}); len(config.Layers) != 0 {
+		t.Fatalf("ConfigOf unknown onion = %s, want no layers", config.Spec())
+	}
+
+	o, err = New(newDialer("net"), newWrap("enc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{Layers: []*LayerConfig{{Name: "net"}, {Name: "enc"}}}
+	if config := ConfigOf(o); !reflect.DeepEqual(config, want) {
+		t.Fatalf("ConfigOf onion created with options = %#v, want %#v", config, want)
+	}
+
+	if _, err := FromSpec("test-net+"); !errors.Is(err, ErrSpec) {
+		t.Fatalf("FromSpec error = %v, want %v", err, ErrSpec)
+	}
+}
@@ -0,0 +1,190 @@
+package onion
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrNoDialer - Onion has no dialer layer.
+	ErrNoDialer = errors.New("onion: no dialer layer")
+
+	// ErrNoListener - Onion has no listener source layer and no listener was given.
+	ErrNoListener = errors.New("onion: no listener source layer nor input listener")
+)
+
+// Validate - Checks roles and order of layers, it's called by New.
+//
+// Every layer has to implement at least one role.
+// Dial path starts with a dialer followed by chain dialers and wrappers.
+// Listen path starts with a listener source followed by listener wrappers.
+// Stacks without a dialer or a listener source are valid, they can't dial
+// or have to be given a listener, see ValidateDial and ValidateListen
+// to check an onion can be used for one of them.
+func Validate(layers ...Layer) error {
+	return validate(layers)
+}
+
+// ValidateDial - Returns ErrNoDialer if the onion can't dial.
+func ValidateDial(o Onion) error {
+	if len(o.Describe().Dial) == 0 {
+		return ErrNoDialer
+	}
+	return nil
+}
+
+// ValidateListen - Returns ErrNoListener if the onion can't listen
+// without an input listener.
+func ValidateListen(o Onion) error {
+	listen := o.Describe().Listen
+	if len(listen) == 0 || listen[0].Role != RoleListen {
+		return ErrNoListener
+	}
+	return nil
+}
+
+func validate(layers []Layer) error {
+	if len(layers) == 0 {
+		return errors.New("onion: no layers")
+	}
+	var dialer, wrapper, source, listenerWrapper Layer
+	for index, layer := range layers {
+		if layer == nil {
+			return fmt.Errorf("onion: layer %d is nil", index)
+		}
+		roles := 0
+		if _, ok := layer.(Dialer); ok {
+			roles++
+			_, chain := layer.(ChainDialer)
+			switch {
+			case dialer == nil && wrapper != nil:
+				return fmt.Errorf("onion: dialer %s follows %s wrapping connections, dialer has to be first", layer.Name(), wrapper.Name())
+			case dialer != nil && !chain:
+				return fmt.Errorf("onion: dialer %s follows dialer %s and can't dial through it", layer.Name(), dialer.Name())
+			case dialer == nil:
+				dialer = layer
+			}
+		}
+		if _, ok := layer.(Wrapper); ok {
+			roles++
+			if wrapper == nil {
+				wrapper = layer
+			}
+		}
+		if _, ok := layer.(ListenerSource); ok {
+			roles++
+			switch {
+			case source != nil:
+				return fmt.Errorf("onion: listener source %s follows listener source %s", layer.Name(), source.Name())
+			case listenerWrapper != nil:
+				return fmt.Errorf("onion: listener source %s follows %s wrapping listeners, listener source has to be first", layer.Name(), listenerWrapper.Name())
+			}
+			source = layer
+		}
+		if _, ok := layer.(ListenerWrapper); ok {
+			roles++
+			if listenerWrapper == nil {
+				listenerWrapper = layer
+			}
+		}
+		if roles == 0 {
+			return fmt.Errorf("onion: layer %s is neither a dialer, wrapper, listener source nor listener wrapper", layer.Name())
+		}
+	}
+	return nil
+}
+
+// Step roles.
+const (
+	RoleDial          = "dial"
+	RoleDialThrough   = "dial through"
+	RoleWrap          = "wrap"
+	RoleListen        = "listen"
+	RoleWrapListener  = "wrap listener"
+	RoleInputListener = "input listener"
+)
+
+// Step - Step of a dial or listen path.
+type Step struct {
+	// Layer - Layer name, empty for input listener.
+	Layer string
+
+	// Index - Index of the layer in the onion, -1 for input listener
+	// and steps which are not onion layers, like mux.New sessions.
+	Index int
+
+	// Role - What the layer does in the path, one of Role constants.
+	Role string
+}
+
+// String - Returns layer name followed by its role, for example "tor dial through".
+func (step Step) String() string {
+	if step.Layer == "" {
+		return step.Role
+	}
+	return step.Layer + " " + step.Role
+}
+
+// Description - Dial and listen paths of an onion.
+type Description struct {
+	// Dial - Steps of Connect, empty if the onion can't dial.
+	Dial []Step
+
+	// Listen - Steps of Listener(nil), starting with input listener
+	// if there is no listener source layer.
+	Listen []Step
+}
+
+// String - Returns paths in two lines, for example:
+//
+//	dial: tor dial => sch wrap
+//	listen: net listen => tor wrap listener => sch wrap listener
+func (desc *Description) String() string {
+	return "dial: " + formatPath(desc.Dial) + "\nlisten: " + formatPath(desc.Listen)
+}
+
+func formatPath(steps []Step) string {
+	if len(steps) == 0 {
+		return "none"
+	}
+	s := make([]string, len(steps))
+	for i, step := range steps {
+		s[i] = step.String()
+	}
+	return strings.Join(s, " => ")
+}
+
+// describe - Returns dial and listen paths of layers
+// as they are used by Connect and Listener.
+func describe(layers []Layer) *Description {
+	desc := new(Description)
+	for index, layer := range layers {
+		if layer == nil {
+			continue
+		}
+		step := Step{Layer: layer.Name(), Index: index}
+		if _, ok := layer.(Dialer); ok && len(desc.Dial) == 0 {
+			step.Role = RoleDial
+			desc.Dial = append(desc.Dial, step)
+		} else if _, ok := layer.(ChainDialer); ok && len(desc.Dial) > 0 {
+			step.Role = RoleDialThrough
+			desc.Dial = append(desc.Dial, step)
+		} else if _, ok := layer.(Wrapper); ok && len(desc.Dial) > 0 {
+			step.Role = RoleWrap
+			desc.Dial = append(desc.Dial, step)
+		}
+
+		if _, ok := layer.(ListenerSource); ok && len(desc.Listen) == 0 {
+			step.Role = RoleListen
+			desc.Listen = append(desc.Listen, step)
+		} else if _, ok := layer.(ListenerWrapper); ok {
+			if len(desc.Listen) == 0 {
+				desc.Listen = append(desc.Listen, Step{Index: -1, Role: RoleInputListener})
+			}
+			step.Role = RoleWrapListener
+			desc.Listen = append(desc.Listen, step)
+		}
+	}
+	return desc
+}
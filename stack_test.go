@@ -0,0 +1,161 @@
+package onion
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		layers []Layer
+		err    string
+	}{
+		{name: "dialer", layers: []Layer{newDialer("net")}},
+		{name: "source", layers: []Layer{newSource("net")}},
+		{name: "wrapper", layers: []Layer{newWrap("enc")}},
+		{name: "dial path", layers: []Layer{newDialer("net"), newChainDialer("proxy", "proxy:1080"), newWrap("enc"), newWrapper("b")}},
+		{name: "chain dialer after wrapper", layers: []Layer{newDialer("net"), newWrap("tls"), newChainDialer("proxy", "proxy:1080")}},
+		{name: "listen path", layers: []Layer{newSource("net"), newListenerWrapper("service"), newWrap("enc")}},
+		{name: "both paths", layers: []Layer{&testNet{testDialer: *newDialer("net")}, newWrap("enc")}},
+		{
+			name: "no layers",
+			err:  "onion: no layers",
+		},
+		{
+			name:   "nil layer",
+			layers: []Layer{newDialer("net"), nil},
+			err:    "onion: layer 1 is nil",
+		},
+		{
+			name:   "no roles",
+			layers: []Layer{newDialer("net"), &testLayer{name: "none"}},
+			err:    "onion: layer none is neither a dialer, wrapper, listener source nor listener wrapper",
+		},
+		{
+			name:   "wrapper before dialer",
+			layers: []Layer{newWrapper("enc"), newDialer("net")},
+			err:    "onion: dialer net follows enc wrapping connections, dialer has to be first",
+		},
+		{
+			name:   "wrapper before chain dialer",
+			layers: []Layer{newWrapper("enc"), newChainDialer("proxy", "proxy:1080")},
+			err:    "onion: dialer proxy follows enc wrapping connections, dialer has to be first",
+		},
+		{
+			name:   "dialer after dialer",
+			layers: []Layer{newDialer("net"), newDialer("tor")},
+			err:    "onion: dialer tor follows dialer net and can't dial through it",
+		},
+		{
+			name:   "two sources",
+			layers: []Layer{newSource("net"), newSource("tor")},
+			err:    "onion: listener source tor follows listener source net",
+		},
+		{
+			name:   "source after listener wrapper",
+			layers: []Layer{newListenerWrapper("service"), newSource("net")},
+			err:    "onion: listener source net follows service wrapping listeners, listener source has to be first",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.layers...)
+			if test.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || err.Error() != test.err {
+				t.Fatalf("Validate error = %v, want %q", err, test.err)
+			}
+			if _, err := New(test.layers...); err == nil || err.Error() != test.err {
+				t.Fatalf("New error = %v, want %q", err, test.err)
+			}
+		})
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		layers []Layer
+		desc   string
+		dial   error
+		listen error
+	}{
+		{
+			name:   "dialer",
+			layers: []Layer{newDialer("net"), newChainDialer("proxy", "proxy:1080"), newWrapper("enc")},
+			desc:   "dial: net dial => proxy dial through => enc wrap\nlisten: none",
+			listen: ErrNoListener,
+		},
+		{
+			name:   "source",
+			layers: []Layer{newSource("net"), newListenerWrapper("service"), newWrap("enc")},
+			desc:   "dial: none\nlisten: net listen => service wrap listener => enc wrap listener",
+			dial:   ErrNoDialer,
+		},
+		{
+			name:   "both",
+			layers: []Layer{&testNet{testDialer: *newDialer("net")}, newWrap("enc")},
+			desc:   "dial: net dial => enc wrap\nlisten: net listen => enc wrap listener",
+		},
+		{
+			name:   "input listener",
+			layers: []Layer{newWrap("enc")},
+			desc:   "dial: none\nlisten: input listener => enc wrap listener",
+			dial:   ErrNoDialer,
+			listen: ErrNoListener,
+		},
+		{
+			name:   "dialer without source",
+			layers: []Layer{newDialer("net"), newWrap("enc")},
+			desc:   "dial: net dial => enc wrap\nlisten: input listener => enc wrap listener",
+			listen: ErrNoListener,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			o, err := New(test.layers...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			desc := o.Describe()
+			if s := desc.String(); s != test.desc {
+				t.Fatalf("description:\n%s\nwant:\n%s", s, test.desc)
+			}
+			for _, path := range [][]Step{desc.Dial, desc.Listen} {
+				for _, step := range path {
+					if step.Index >= 0 && test.layers[step.Index].Name() != step.Layer {
+						t.Errorf("step %s has index %d of layer %s", step, step.Index, test.layers[step.Index].Name())
+					}
+				}
+			}
+			if err := ValidateDial(o); !errors.Is(err, test.dial) {
+				t.Errorf("ValidateDial error = %v, want %v", err, test.dial)
+			}
+			if err := ValidateListen(o); !errors.Is(err, test.listen) {
+				t.Errorf("ValidateListen error = %v, want %v", err, test.listen)
+			}
+		})
+	}
+}
+
+func TestStepString(t *testing.T) {
+	for _, test := range []struct {
+		step Step
+		want string
+	}{
+		{Step{Layer: "tor", Index: 1, Role: RoleDialThrough}, "tor dial through"},
+		{Step{Layer: "net", Role: RoleListen}, "net listen"},
+		{Step{Index: -1, Role: RoleInputListener}, "input listener"},
+	} {
+		if s := test.step.String(); s != test.want {
+			t.Errorf("step %#v = %q, want %q", test.step, s, test.want)
+		}
+	}
+	if s := (&Description{}).String(); !strings.Contains(s, "dial: none") || !strings.Contains(s, "listen: none") {
+		t.Errorf("empty description = %q", s)
+	}
+}